@@ -0,0 +1,278 @@
+package spell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Checker checks words against a spelling list compiled by pcode,
+// deriving words from the list by the affix rules of v10spell.
+// A Checker is safe for concurrent use by multiple goroutines.
+type Checker struct {
+	md      Metadata
+	encodes []bits
+	words   wordSet
+	suf     []suffix     // suffix rules (British rules after ise)
+	pref    []prefix     // prefix rules
+	british bool         // if set, suf takes -ise for -ize
+	x       io.Writer    // if not nil, stems looked up are traced on x (spell -x)
+	unmap   func() error // if not nil, releases the file mapped by Open
+
+	once    sync.Once // builds auto for Complete and Suggest
+	auto    *dawg
+	autoErr error
+}
+
+// NewChecker returns a Checker for the compiled spelling list read from r
+func NewChecker(r io.Reader) (*Checker, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newChecker(data)
+}
+
+// Returns a Checker for the compiled spelling list data. Indexed,
+// hashed and automaton lists are used in place, without checking their
+// checksum; others are decoded
+func newChecker(data []byte) (*Checker, error) {
+	c := &Checker{suf: suffixes, pref: prefixes}
+	md, body, base, err := parseDict(data, false)
+	if err != nil {
+		return nil, err
+	}
+	var n int // number of words, or hashes
+	switch md.Version {
+	case indexVersion:
+		x, encodes, err := openIndex(body, base)
+		if err != nil {
+			return nil, err
+		}
+		c.encodes, c.words, n = encodes, x, x.len()
+	case hashVersion:
+		h, encodes, err := openHashed(body, base)
+		if err != nil {
+			return nil, err
+		}
+		c.encodes, c.words, n = encodes, h, h.n
+	case dawgVersion:
+		d, encodes, err := openDAWG(body, base)
+		if err != nil {
+			return nil, err
+		}
+		c.encodes, c.words, c.auto = encodes, d, d
+		n = md.Words // counting the words would walk the whole automaton
+	default:
+		x := new(index)
+		if c.encodes, err = decodeBody(&md, body, base, x.add); err != nil {
+			return nil, err
+		}
+		x.build()
+		c.words, n = x, x.len()
+	}
+	if err := md.checkCounts(n, len(c.encodes), base); err != nil {
+		return nil, err
+	}
+	c.md = md
+	return c, nil
+}
+
+// Metadata returns the description of the spelling list. Only the
+// counts are known for dictionaries in the legacy format
+func (c *Checker) Metadata() Metadata {
+	md := c.md
+	md.Sources = append([]string(nil), c.md.Sources...)
+	return md
+}
+
+// Open returns a Checker for the compiled spelling list in the named
+// file. Where possible the file is mapped into memory, and an indexed
+// list (pcode -index, -hash or -dawg) is used where it lies, so that
+// opening one takes the same short time whatever its size. Its checksum
+// is then not checked; pcode -d checks it. The file must not change
+// while the Checker is in use
+func Open(path string) (*Checker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("trouble reading %s: %w", path, err)
+	}
+	c, err := newChecker(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("trouble reading %s: %w", path, err)
+	}
+	if inPlace(c.md.Version) {
+		c.unmap = unmap
+	} else if err := unmap(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Returns the contents of f, read into memory, and a function that
+// does nothing, for mapFile where f cannot be mapped
+func readFile(f *os.File) ([]byte, func() error, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
+
+// Close releases the memory mapping of a Checker returned by Open, which
+// must not be used afterwards. Other Checkers hold nothing to release
+func (c *Checker) Close() error {
+	if c.unmap == nil {
+		return nil
+	}
+	unmap := c.unmap
+	c.unmap = nil
+	return unmap()
+}
+
+// OpenFS returns a Checker for the compiled spelling list in the named
+// file of fsys
+func OpenFS(fsys fs.FS, name string) (*Checker, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newChecker(data)
+	if err != nil {
+		return nil, fmt.Errorf("trouble reading %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// Returns the affix classes of w in the spelling list, 0 if absent
+func (c *Checker) lookup(w []byte) bits {
+	if i := c.words.lookup(w); i >= 0 && i < len(c.encodes) {
+		return c.encodes[i]
+	}
+	return 0
+}
+
+// Check reports whether word is in the spelling list or derivable from
+// it, and not on the stop list. Words are compared in Unicode NFC
+func (c *Checker) Check(word string) bool {
+	_, h := c.query(word)
+	return h != 0 && !isSet(h, STOP)
+}
+
+// Looks up word, returning the query, which holds the derivation found,
+// and the affix classes of the stem
+func (c *Checker) query(word string) (*query, bits) {
+	word = norm.NFC.String(word)
+	q := newQuery(word, c.lookup)
+	q.suf = c.suf
+	q.pref = c.pref
+	q.x = c.x
+	if word == "" {
+		return q, 0
+	}
+	return q, q.check()
+}
+
+// CheckText returns the misspelled words of the text read from r,
+// sorted and without repetition. Words are split as by deroff -w
+func (c *Checker) CheckText(r io.Reader) ([]string, error) {
+	s := bufio.NewScanner(r)
+	s.Split(scanWords)
+	seen := make(map[string]bool)
+	misspelled := make([]string, 0)
+	for s.Scan() {
+		word := s.Text()
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		if !c.Check(word) {
+			misspelled = append(misspelled, word)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(misspelled)
+	return misspelled, nil
+}
+
+// Returns the automaton of the spelling list, built from the index on
+// first use unless the list was compiled as one. Hashed lists have none
+func (c *Checker) automaton() (*dawg, error) {
+	c.once.Do(func() {
+		if c.auto != nil {
+			return
+		}
+		x, ok := c.words.(*index)
+		if !ok {
+			c.autoErr = dictError(0, "", ErrHashed)
+			return
+		}
+		words := make([]dict, x.len())
+		for k := range words {
+			words[k] = dict{i: u32(x.code, k), word: string(x.word(k))}
+		}
+		c.auto = newDAWG(words)
+	})
+	return c.auto, c.autoErr
+}
+
+// Complete returns the words of the spelling list starting with prefix,
+// in order, at most max of them if max is positive. Derived words and
+// those on the stop list are not returned
+func (c *Checker) Complete(prefix string, max int) ([]string, error) {
+	d, err := c.automaton()
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, 0)
+	d.prefix([]byte(norm.NFC.String(prefix)), func(word []byte, i int) bool {
+		if i < len(c.encodes) && !isSet(c.encodes[i], STOP) {
+			words = append(words, string(word))
+		}
+		return max <= 0 || len(words) < max
+	})
+	return words, nil
+}
+
+// Suggest returns the words of the spelling list at most dist edits from
+// word, an edit inserting, deleting or replacing a character, nearest
+// first and otherwise in order. Derived words and those on the stop list
+// are not returned
+func (c *Checker) Suggest(word string, dist int) ([]string, error) {
+	d, err := c.automaton()
+	if err != nil {
+		return nil, err
+	}
+	type near struct {
+		word  string
+		edits int
+	}
+	var found []near
+	d.fuzzy([]byte(norm.NFC.String(word)), dist, func(w []byte, i, edits int) {
+		if i < len(c.encodes) && !isSet(c.encodes[i], STOP) {
+			found = append(found, near{string(w), edits})
+		}
+	})
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].edits < found[j].edits
+	})
+	words := make([]string, len(found))
+	for k, f := range found {
+		words[k] = f.word
+	}
+	return words, nil
+}
@@ -0,0 +1,224 @@
+package spell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckText(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	text := "Teh happiness of the unreadable\nmanuscript was teh accidently FORGOTTEN one.\n"
+	got, err := c.CheckText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Teh", "accidently", "teh"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	data, _, _ := testDictFile(t, Metadata{Language: "en"}, testList(t, amspellPaths...))
+	path := filepath.Join(t.TempDir(), "amspell")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenFS(os.DirFS(filepath.Dir(path)), filepath.Base(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Check("aardvarks") {
+		t.Fatalf("aardvarks not found")
+	}
+	if _, err := OpenFS(os.DirFS(filepath.Dir(path)), "missing"); err == nil {
+		t.Fatalf("expected error opening a missing dictionary")
+	}
+}
+
+func TestNewCheckerErrors(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		err    error
+		offset int64
+	}{
+		{[]byte{}, ErrTruncated, 0},
+		{[]byte{0x00}, ErrTruncated, 0},
+		{[]byte{0x00, 0x02, 0x00, 0x00}, ErrTruncated, 0},
+		{[]byte{0x00, 0x01, 0, 0, 0, 4, 0x80}, ErrTruncated, 6},
+		{[]byte{0x00, 0x01, 0, 0, 0, 4, 0x00, 0x00, 'a', 'b'}, ErrBadEntry, 6},
+		{[]byte{0x00, 0x00, 0x88, 0x00, 'a', 'b'}, ErrBadEntry, 2}, // 1 repeated char without a previous word
+		{[]byte{0x00, 0x01, 0, 0, 0, 4, 0x80, 0x01, 'a', 'b'}, ErrBadCode, 6},
+		{[]byte{0x00, 0x01, 0, 0, 0, 4, 0x80, 0x00, 'b', 'b', 0x80, 0x00, 'a', 'b'}, ErrUnsorted, 10},
+	}
+	for _, test := range tests {
+		_, err := NewChecker(bytes.NewReader(test.data))
+		var de *DictError
+		if !errors.Is(err, test.err) || !errors.As(err, &de) || de.Offset != test.offset {
+			t.Errorf("NewChecker(% x) = %v, want %v at offset %d", test.data, err, test.err, test.offset)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	var buf bytes.Buffer
+	err := Compile(&buf, Metadata{}, strings.NewReader("fib\tn,v,er,ms\n"), strings.NewReader("aardvark\tn\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewChecker(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Check("fibbing") || !c.Check("aardvarks") {
+		t.Fatalf("compiled dictionary misses words")
+	}
+	if err := Compile(&buf, Metadata{}, strings.NewReader("fib\tn,v,bogus\n")); err == nil {
+		t.Fatalf("expected error for an unknown affix code")
+	}
+}
+
+func TestCheckUTF8(t *testing.T) {
+	c := testChecker(t, Metadata{}, "café\tn\nZürich\tpc\néclair\tn\nnaïve\ta\nnaïveté\tn\ncat\tn\n")
+	words := map[string]bool{
+		"café":       true,
+		"cafés":      true,
+		"cafe\u0301": true, // decomposed
+		"Café":       true,
+		"CAFÉ":       true,
+		"Zürich":     true,
+		"Zürich's":   true,
+		"ZÜRICH":     true,
+		"zürich":     false,
+		"éclairs":    true,
+		"Éclair":     true,
+		"naïvely":    true,
+		"naïvetés":   true,
+		"naive":      false,
+		"cafe":       false,
+		"cats":       true,
+	}
+	for word, want := range words {
+		if got := c.Check(word); got != want {
+			t.Errorf("Check(%q) = %v, want %v", word, got, want)
+		}
+	}
+	if err := Compile(io.Discard, Metadata{}, strings.NewReader("caf\xe9\tn\n")); !errors.Is(err, ErrWordChar) {
+		t.Errorf("Compile of Latin-1 list: err = %v, want %v", err, ErrWordChar)
+	}
+}
+
+// Capitals whose lower case is encoded in a different number of bytes
+// are lowered too, and do not keep check from finishing
+func TestCheckCaseLength(t *testing.T) {
+	c := testChecker(t, Metadata{}, "istanbul\tpc\nßtraße\tn\nkelvin\tn\nⱥpple\tn\n")
+	words := map[string]bool{
+		"İstanbul":     true,
+		"İSTANBUL":     true,
+		"ẞtraße":       true,
+		"ẞtraßes":      true,
+		"\u212aelvin":  true, // Kelvin sign
+		"\u212aELVINS": true,
+		"Ⱥpple":        true,
+		"İzmir":        false,
+		"ẞ":            false,
+	}
+	done := make(chan bool)
+	go func() {
+		for word, want := range words {
+			if got := c.Check(word); got != want {
+				t.Errorf("Check(%q) = %v, want %v", word, got, want)
+			}
+		}
+		if _, err := c.CheckText(strings.NewReader("See İstanbul today.")); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Check does not finish")
+	}
+}
+
+func TestCheckOneLetter(t *testing.T) {
+	c := testChecker(t, Metadata{}, "a\tn\nI\tpc\nas\tn\nx\tn\n")
+	words := map[string]bool{
+		"a":  true,
+		"A":  true,
+		"I":  true,
+		"i":  false,
+		"x":  true,
+		"as": true,
+		"xs": false, // one-letter words are not stems
+		"b":  false,
+		"":   false,
+	}
+	for word, want := range words {
+		if got := c.Check(word); got != want {
+			t.Errorf("Check(%q) = %v, want %v", word, got, want)
+		}
+	}
+}
+
+func TestOpenIndexed(t *testing.T) {
+	data, _, _ := testDictFile(t, Metadata{Version: indexVersion}, "fib\tn,v,er,ms\naardvark\tn\n")
+	path := filepath.Join(t.TempDir(), "amspell")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := c.Metadata(); md.Version != indexVersion || md.Words != 2 {
+		t.Errorf("metadata = %+v", md)
+	}
+	if !c.Check("fibbing") || !c.Check("aardvarks") || c.Check("aardwolf") {
+		t.Errorf("indexed dictionary checks wrongly")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestCheckerConcurrent(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	words := map[string]bool{
+		"happiness":     true,
+		"unreadable":    true,
+		"immunotherapy": true,
+		"fibbing":       true,
+		"readability":   true,
+		"teh":           false,
+		"accidently":    false,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for word, ok := range words {
+					if c.Check(word) != ok {
+						t.Errorf("%s: got %v, want %v", word, !ok, ok)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/ughe/spell"
+
+func main() {
+	spell.Rulelint()
+}
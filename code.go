@@ -9,7 +9,7 @@ import (
 
 type (
 	bits uint32
-	op   func(ep, dd, a string, lev, flag uint32) bits
+	op   func(q *query, ep int, d, a string, lev int, flag bits) bits
 )
 
 const (
@@ -66,28 +66,68 @@ func strToCode(s string) (bits, error) {
 	for _, name := range strings.Split(strings.TrimSpace(s), ",") {
 		b, ok := nameCodes[name]
 		if !ok {
-			return code, fmt.Errorf("Unknown affix code \"%s\"\n", name)
+			return code, fmt.Errorf("%w %q", ErrAffixCode, name)
 		}
 		code = code | b
 	}
 	return code, nil
 }
 
+// Order of names in the annotated lists, as output by codeToNames
+var nameOrder []string = []string{
+	"n", "pc", "d", "v", "vi", "ed", "a", "adv", "er", "comp",
+	"ion", "na", "va", "man", "in", "nopref", "ms", "y", "s",
+}
+
+// Converts bits to a comma-separated string of bits identifiers, the
+// inverse of strToCode. Composite identifiers (v, comp) are used
+// whenever all of their bits are set. Bits without an identifier are
+// output in hexadecimal
+func codeToNames(code bits) string {
+	names := make(map[string]bool)
+	rest := code
+	take := func(name string) {
+		if b := nameCodes[name]; rest&b == b {
+			names[name] = true
+			rest &^= b
+		}
+	}
+	take("v")
+	take("comp")
+	for _, name := range nameOrder {
+		take(name)
+	}
+	buf := ""
+	for _, name := range nameOrder {
+		if names[name] {
+			buf += "," + name
+		}
+	}
+	if rest != 0 || buf == "" {
+		buf += fmt.Sprintf(",%#x", uint32(rest))
+	}
+	return buf[1:] // Strip leading ','
+}
+
 // Outputs | separated string of bits names (excluding composite ones)
+// in order of increasing bit, or "0" if no bits are set
 func codeToStr(code bits) string {
 	buf := ""
-	for k, v := range codeNames {
-		if code&k != 0 {
+	for k := bits(1); k != 0; k <<= 1 {
+		if v, ok := codeNames[k]; ok && code&k != 0 {
 			buf += "|" + v
 		}
 	}
+	if buf == "" {
+		return "0"
+	}
 	return buf[1:] // Strip leading '|'
 }
 
 // Excludes composit COMP, ALL, and VERB names
 var codeNames map[bits]string = map[bits]string{
 	ED:           "ED",
-	ADJ:          "AD",
+	ADJ:          "ADJ",
 	NOUN:         "NOUN",
 	PROP_COLLECT: "PROP_COLLECT",
 	ACTOR:        "ACTOR",
@@ -125,110 +165,287 @@ var opCodes map[string]op = map[string]op{
 
 // Returns true if character is a vowel
 // Implementation notes: Original C uses a LUT of [128]bool
-// Instead of for loop, could also use map, switch, boolean or
-func isVowel(c rune) bool {
-	vowels := "aeiouyAEIOUY"
-	for _, s := range vowels {
-		if c == s {
-			return true
-		}
-	}
-	return false
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiouyAEIOUY", c) >= 0
 }
 
-func nop(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+func isUpper(c byte) bool {
+	return 'A' <= c && c <= 'Z'
 }
 
-func cstrip(ep, dd, a string, lev, flag uint32) bits {
-	/*
-		if isVowel(ep[0]) && isVowel(ep[-1]) {
-			// TODO:
-			// if (ep[-1], ep[0]) ==
-			// a,a
-			// a,e
-			// a,i
-			// e,a
-			// e,e
-			// e,i
-			// i,i
-			// o,a
-			return 0
-		} else if ep[0] == ep[-1] && ep[0] == ep[-2] {
-			return 0
-		} else {
-			return strip(ep, d, a, lev, flag)
-		}
-	*/
-	return 0
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
 }
 
 func isSet(a, b bits) bool {
 	return (a & b) != 0
 }
 
-func strip(ep, dd, a string, lev, flag uint32) bits {
-	/*
-		var h bits = trypref(ep, a, lev, flag)
-		if !(isSet(h, MONO) && isVowel(ep[0]) && isVowel(ep[-2])) {
-			return h
+// Ops are called with ep, the end of the stem left in q.word after
+// removing n bytes of the suffix, the deletion/addition strings d and a
+// describing the derivation, the derivation level lev and the flag
+// the stem must satisfy. Ops may rewrite bytes of q.word around ep but
+// must restore them before returning.
+
+func nop(q *query, ep int, d, a string, lev int, flag bits) bits {
+	return 0
+}
+
+// strip off the suffix, but refuse vowel pairs and tripled letters
+// that the stem could not have ended with
+func cstrip(q *query, ep int, d, a string, lev int, flag bits) bits {
+	c := q.at(ep)
+	if isVowel(c) && isVowel(q.at(ep-1)) {
+		switch pair(q.at(ep-1), c) {
+		case pair('a', 'a'), pair('a', 'e'), pair('a', 'i'),
+			pair('e', 'a'), pair('e', 'e'), pair('e', 'i'),
+			pair('i', 'i'), pair('o', 'a'):
+			return 0
 		}
-		if isVowel(ep[0]) && !isVowel(ep[-1]) && ep[-1] == ep[-2] {
-			h = trypref(ep-1, a, lev, flag|MONO)
-			if h != 0 {
-				return h
-			}
-			return trysuff(ep, lev, flag)
+	} else if c == q.at(ep-1) && c == q.at(ep-2) {
+		return 0
+	}
+	return strip(q, ep, d, a, lev, flag)
+}
+
+// strip off the suffix and look up the stem, allowing for a doubled
+// final consonant (fib -> fibbing) on MONO stems
+func strip(q *query, ep int, d, a string, lev int, flag bits) bits {
+	h := q.trypref(ep, a, lev, flag)
+	if isSet(h, MONO) && isVowel(q.at(ep)) && isVowel(q.at(ep-2)) {
+		h = 0
+	}
+	if h != 0 {
+		return h
+	}
+	if isVowel(q.at(ep)) && !isVowel(q.at(ep-1)) && q.at(ep-1) == q.at(ep-2) {
+		h = q.trypref(ep-1, a, lev, flag|MONO)
+		if h != 0 {
+			return h
 		}
-	*/
-	return 0
+	}
+	return q.trysuff(ep, lev, flag)
 }
 
-func ize(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// -ize, -ization: restore the final e
+func ize(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if ep < 1 {
+		return 0
+	}
+	c := q.word[ep-1]
+	q.word[ep-1] = 'e'
+	h := strip(q, ep, "", d, lev, flag)
+	q.word[ep-1] = c
+	return h
 }
 
-func i_to_y(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// turn a final i back into y (happier -> happy)
+func i_to_y(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if isUpper(q.word[0]) {
+		return 0
+	}
+	if q.at(ep-1) == 'i' && !isVowel(q.at(ep-2)) {
+		q.word[ep-1] = 'y'
+		h := cstrip(q, ep, "", d, lev, flag)
+		q.word[ep-1] = 'i'
+		return h
+	}
+	return cstrip(q, ep, "", a, lev, flag)
 }
 
-func ily(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// -ily, -iness, -iful...: refuse happyly and sillly, but not shyly
+func ily(q *query, ep int, d, a string, lev int, flag bits) bits {
+	c := q.at(ep)
+	if c == q.at(ep-1) && c == q.at(ep-2) {
+		return 0
+	}
+	if q.at(ep-1) == 'y' && !isVowel(q.at(ep-2)) {
+		for i := ep - 3; i >= 0; i-- {
+			if isVowel(q.word[i]) {
+				return 0
+			}
+		}
+	}
+	if q.at(ep-1) == 'i' {
+		return i_to_y(q, ep, d, a, lev, flag)
+	}
+	return cstrip(q, ep, d, a, lev, flag)
 }
 
-func subst(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// put back the end of the stem deleted by the suffix, as described by
+// d: -t+ce turns dependenc(e) into dependent
+func subst(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if skipv(q, skipv(q, ep-1)) < 0 {
+		return 0
+	}
+	minus := strings.IndexByte(d, '-')
+	plus := strings.IndexByte(d, '+')
+	del := d[minus+1 : plus]
+
+	// the stem ends at ep with the deletion in place of the addition
+	u := ep - len(del)
+	if u < 0 || ep > len(q.word) {
+		return 0
+	}
+	saved := make([]byte, len(del))
+	copy(saved, q.word[u:ep])
+	copy(q.word[u:], del)
+	h := strip(q, ep, "", d, lev, flag)
+	copy(q.word[u:], saved)
+	return h
 }
 
-func CCe(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// consonant-consonant-e endings, as in -able, -ing
+func CCe(q *query, ep int, d, a string, lev int, flag bits) bits {
+	switch q.at(ep - 1) {
+	case 'l':
+		if isVowel(q.at(ep - 2)) {
+			break
+		}
+		switch q.at(ep - 2) {
+		case 'l', 'r', 'w':
+		default:
+			return y_to_e(q, ep, d, a, lev, flag)
+		}
+	case 'c', 'g':
+		if q.at(ep) == 'a' { // prevent -able for -eable
+			return 0
+		}
+		fallthrough
+	case 's', 'v', 'z':
+		if q.at(ep-2) == q.at(ep-1) || isVowel(q.at(ep-2)) {
+			break
+		}
+		fallthrough
+	case 'u':
+		if h := y_to_e(q, ep, d, a, lev, flag); h != 0 {
+			return h
+		}
+		if !(q.at(ep-2) == 'n' && q.at(ep-1) == 'g') {
+			return 0
+		}
+	}
+	return VCe(q, ep, d, a, lev, flag)
 }
 
-func tion(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// -tion, -ator: a vowel before the t means the stem ended in e
+func tion(q *query, ep int, d, a string, lev int, flag bits) bits {
+	switch q.at(ep - 2) {
+	case 'a', 'e', 'i', 'o', 'u':
+		return y_to_e(q, ep, d, a, lev, flag)
+	}
+	return q.trypref(ep, a, lev, flag)
 }
 
-func an(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// -an, -ian: only for proper names
+func an(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if !isUpper(q.word[0]) {
+		return 0
+	}
+	return q.trypref(ep, a, lev, flag)
 }
 
-func s(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// plural and third person -s, which must not follow s, x, z, sh, ch or
+// a consonant-y (but Kennedys is fine)
+func s(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if lev > dLEV+1 {
+		return 0
+	}
+	if q.at(ep) == 's' {
+		switch q.at(ep - 1) {
+		case 'y':
+			if isVowel(q.at(ep-2)) || isUpper(q.word[0]) {
+				break
+			}
+			return 0
+		case 'x', 'z', 's':
+			return 0
+		case 'h':
+			switch q.at(ep - 2) {
+			case 'c', 's':
+				return 0
+			}
+		}
+	}
+	return strip(q, ep, d, a, lev, flag)
 }
 
-func es(ep, dd, a string, lev, flag uint32) bits {
+// plural and third person -es, after s, x, z, sh, ch or y -> ies
+func es(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if lev > dLEV {
+		return 0
+	}
+	switch q.at(ep - 1) {
+	case 'i':
+		return i_to_y(q, ep, d, a, lev, flag)
+	case 'h':
+		switch q.at(ep - 2) {
+		case 'c', 's':
+			return strip(q, ep, d, a, lev, flag)
+		}
+	case 's', 'z', 'x':
+		return strip(q, ep, d, a, lev, flag)
+	}
 	return 0
 }
 
-func bility(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// -bility: restore -ble
+func bility(q *query, ep int, d, a string, lev int, flag bits) bits {
+	if ep < 0 || ep+1 >= len(q.word) {
+		return 0
+	}
+	c := q.word[ep]
+	q.word[ep] = 'l'
+	h := y_to_e(q, ep+1, d, a, lev, flag)
+	q.word[ep] = c
+	return h
 }
 
-func y_to_e(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// restore a final e replaced by the suffix (ably -> able)
+func y_to_e(q *query, ep int, d, a string, lev int, flag bits) bits {
+	switch q.at(ep - 1) {
+	case 'a', 'e', 'i':
+		return 0
+	}
+	if ep < 0 || ep >= len(q.word) {
+		return 0
+	}
+	c := q.word[ep]
+	q.word[ep] = 'e'
+	h := strip(q, ep+1, "", d, lev, flag)
+	q.word[ep] = c
+	return h
 }
 
-func VCe(ep, dd, a string, lev, flag uint32) bits {
-	return 0
+// possible vowel-consonant-e ending
+func VCe(q *query, ep int, d, a string, lev int, flag bits) bits {
+	c := q.at(ep - 1)
+	if c == 'e' {
+		return 0
+	}
+	if !isVowel(c) && isVowel(q.at(ep-2)) && ep < len(q.word) {
+		c = q.word[ep]
+		q.word[ep] = 'e'
+		h := q.trypref(ep+1, d, lev, flag)
+		if h == 0 {
+			h = q.trysuff(ep+1, lev, flag)
+		}
+		q.word[ep] = c
+		if h != 0 {
+			return h
+		}
+	}
+	return cstrip(q, ep, d, a, lev, flag)
+}
 
+// Returns the index of the last vowel before the consonants that end
+// at i, skipping a vowel at i itself. Negative if there is none
+func skipv(q *query, i int) int {
+	if i >= 0 && isVowel(q.word[i]) {
+		i--
+	}
+	for i >= 0 && !isVowel(q.word[i]) {
+		i--
+	}
+	return i
 }
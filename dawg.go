@@ -0,0 +1,367 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// A dawg holds a spelling list as a minimized acyclic automaton (a
+// directed acyclic word graph): words sharing a prefix share the path
+// that spells it, and words ending alike, with the same affix code,
+// share the path that spells the ending. Each state that ends a word
+// carries the index of its affix code. States are numbered so that
+// every edge leads to a later state, state 0 being the start. Like an
+// index, the arrays are held as laid out in a file (see writeDAWG).
+type dawg struct {
+	start  []byte // the edges of state s are start[s] to start[s+1]
+	final  []byte // 1 + index in encodes of the code of the word ending at s, 0 if none
+	labels []byte // the byte spelt by each edge, ascending for each state
+	target []byte // the state each edge leads to
+}
+
+// Returns the number of states of d
+func (d *dawg) len() int {
+	return len(d.final) / 4
+}
+
+// Returns the state reached from s by the edge spelling c, -1 if none
+func (d *dawg) next(s int, c byte) int {
+	lo, hi := u32(d.start, s), u32(d.start, s+1)
+	if lo < 0 || lo > hi || hi > len(d.labels) {
+		return -1
+	}
+	k := lo + sort.Search(hi-lo, func(k int) bool { return d.labels[lo+k] >= c })
+	if k == hi || d.labels[k] != c {
+		return -1
+	}
+	if t := u32(d.target, k); t > s && t < d.len() {
+		return t
+	}
+	return -1
+}
+
+// Calls visit with each edge of s, the byte it spells and the state it
+// leads to, in order
+func (d *dawg) edges(s int, visit func(c byte, t int)) {
+	lo, hi := u32(d.start, s), u32(d.start, s+1)
+	if lo < 0 || lo > hi || hi > len(d.labels) {
+		return
+	}
+	for k := lo; k < hi; k++ {
+		if t := u32(d.target, k); t > s && t < d.len() {
+			visit(d.labels[k], t)
+		}
+	}
+}
+
+// Returns the index in encodes of the affix code of w, -1 if w is not
+// in d
+func (d *dawg) lookup(w []byte) int {
+	s := 0
+	for _, c := range w {
+		if s = d.next(s, c); s < 0 {
+			return -1
+		}
+	}
+	return u32(d.final, s) - 1
+}
+
+// Calls visit with the words of d starting with prefix, in order, and
+// the indexes of their codes, until visit returns false
+func (d *dawg) prefix(prefix []byte, visit func(word []byte, i int) bool) {
+	s := 0
+	for _, c := range prefix {
+		if s = d.next(s, c); s < 0 {
+			return
+		}
+	}
+	word := append([]byte(nil), prefix...)
+	var walk func(s int) bool
+	walk = func(s int) bool {
+		if i := u32(d.final, s) - 1; i >= 0 && !visit(word, i) {
+			return false
+		}
+		more := true
+		d.edges(s, func(c byte, t int) {
+			if more {
+				word = append(word, c)
+				more = walk(t)
+				word = word[:len(word)-1]
+			}
+		})
+		return more
+	}
+	walk(s)
+}
+
+// Calls visit with the words of d at most dist edits from w, counting
+// the insertion, deletion or substitution of a character as one, in
+// order, with the indexes of their codes and the number of edits. The
+// automaton is walked with a row of the edit distance table per
+// character, leaving paths no word of which can be near enough
+func (d *dawg) fuzzy(w []byte, dist int, visit func(word []byte, i, edits int)) {
+	runes := []rune(string(w))
+	rows := [][]int{make([]int, len(runes)+1)} // rows[n] after n characters
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	var word []byte
+	var walk func(s, n, pending int)
+	walk = func(s, n, pending int) {
+		row := rows[n]
+		if i := u32(d.final, s) - 1; pending == 0 && i >= 0 && row[len(runes)] <= dist {
+			visit(word, i, row[len(runes)])
+		}
+		d.edges(s, func(c byte, t int) {
+			word = append(word, c)
+			defer func() { word = word[:len(word)-1] }()
+			tail := word[len(word)-pending-1:]
+			if !utf8.FullRune(tail) {
+				walk(t, n, pending+1) // in the middle of a character
+				return
+			}
+			r, _ := utf8.DecodeRune(tail)
+			if len(rows) == n+1 {
+				rows = append(rows, make([]int, len(runes)+1))
+			}
+			next := rows[n+1]
+			next[0] = row[0] + 1
+			low := next[0]
+			for j := 1; j < len(row); j++ {
+				cost := 1
+				if runes[j-1] == r {
+					cost = 0
+				}
+				next[j] = min3(next[j-1]+1, row[j]+1, row[j-1]+cost)
+				if next[j] < low {
+					low = next[j]
+				}
+			}
+			if low <= dist {
+				walk(t, n+1, 0)
+			}
+		})
+	}
+	walk(0, 0, 0)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// A dawgNode is a state of a dawg being built
+type dawgNode struct {
+	labels []byte
+	next   []*dawgNode
+	final  int // as in dawg
+	id     int // number in the register of states, from 1; 0 until registered
+}
+
+// A dawgBuilder builds a dawg from words added in order, merging each
+// state with an equivalent one as soon as no more words can reach it
+// (Daciuk, Mihov, Watson and Watson, "Incremental Construction of
+// Minimal Acyclic Finite-State Automata", 2000)
+type dawgBuilder struct {
+	root     dawgNode
+	last     []byte
+	path     []*dawgNode // the states spelling last, after root
+	register map[string]*dawgNode
+	nstates  int
+}
+
+// Adds word, whose affix code is encodes[i], to b. Words must be added
+// in order; a word added twice keeps its first code
+func (b *dawgBuilder) add(word []byte, i int) {
+	if b.register == nil {
+		b.register = make(map[string]*dawgNode)
+	}
+	if len(b.path) > 0 && bytes.Equal(word, b.last) {
+		return
+	}
+	n := 0 // length of the prefix shared with the last word
+	for n < len(word) && n < len(b.last) && word[n] == b.last[n] {
+		n++
+	}
+	b.minimize(n)
+	s := &b.root
+	if n > 0 {
+		s = b.path[n-1]
+	}
+	for _, c := range word[n:] {
+		t := &dawgNode{}
+		s.labels = append(s.labels, c)
+		s.next = append(s.next, t)
+		b.path = append(b.path, t)
+		s = t
+	}
+	s.final = i + 1
+	b.last = append(b.last[:0], word...)
+}
+
+// Replaces the states of the path after its first n by equivalent
+// registered ones, registering those that have none
+func (b *dawgBuilder) minimize(n int) {
+	for k := len(b.path) - 1; k >= n; k-- {
+		s := b.path[k]
+		parent := &b.root
+		if k > 0 {
+			parent = b.path[k-1]
+		}
+		key := s.key()
+		if t, ok := b.register[key]; ok {
+			parent.next[len(parent.next)-1] = t
+		} else {
+			b.nstates++
+			s.id = b.nstates
+			b.register[key] = s
+		}
+	}
+	b.path = b.path[:n]
+}
+
+// Returns a key equal for equivalent registered states
+func (s *dawgNode) key() string {
+	buf := make([]byte, 0, 4+5*len(s.labels))
+	buf = appendUint32(buf, s.final)
+	for k, c := range s.labels {
+		buf = append(buf, c)
+		buf = appendUint32(buf, s.next[k].id)
+	}
+	return string(buf)
+}
+
+// Returns the dawg of the words added to b
+func (b *dawgBuilder) build() *dawg {
+	b.minimize(0)
+
+	// Number the states in reverse postorder, so edges lead forward
+	var order []*dawgNode
+	seen := make(map[*dawgNode]bool)
+	var visit func(s *dawgNode)
+	visit = func(s *dawgNode) {
+		seen[s] = true
+		for _, t := range s.next {
+			if !seen[t] {
+				visit(t)
+			}
+		}
+		order = append(order, s)
+	}
+	visit(&b.root)
+	number := make(map[*dawgNode]int, len(order))
+	for k := range order {
+		number[order[len(order)-1-k]] = k
+	}
+
+	d := &dawg{}
+	for k := len(order) - 1; k >= 0; k-- {
+		s := order[k]
+		d.start = appendUint32(d.start, len(d.labels))
+		d.final = appendUint32(d.final, s.final)
+		d.labels = append(d.labels, s.labels...)
+		for _, t := range s.next {
+			d.target = appendUint32(d.target, number[t])
+		}
+	}
+	d.start = appendUint32(d.start, len(d.labels))
+	return d
+}
+
+// Returns the dawg of words, which it sorts
+func newDAWG(words []dict) *dawg {
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].word < words[j].word
+	})
+	var b dawgBuilder
+	for _, word := range words {
+		b.add([]byte(word.word), word.i)
+	}
+	return b.build()
+}
+
+// Writes the sorted words and their codes to w as a dawg, which
+// openDAWG uses in place. All numbers are big-endian.
+//
+//	struct {
+//	  ncodes  uint32
+//	  nstates uint32
+//	  nedges  uint32
+//	  encodes [ncodes]uint32
+//	  start   [nstates+1]uint32
+//	  final   [nstates]uint32
+//	  target  [nedges]uint32
+//	  labels  [nedges]byte
+//	}
+//
+// Returns the number of bytes written
+func writeDAWG(words []dict, encodes []bits, w io.Writer) (int, error) {
+	d := newDAWG(words)
+	head := make([]byte, 0, 12+4*len(encodes))
+	for _, n := range []int{len(encodes), d.len(), len(d.labels)} {
+		head = appendUint32(head, n)
+	}
+	for _, c := range encodes {
+		head = appendUint32(head, int(c))
+	}
+	f := bufio.NewWriter(w)
+	nBytes := 0
+	for _, b := range [][]byte{head, d.start, d.final, d.target, d.labels} {
+		n, _ := f.Write(b)
+		nBytes += n
+	}
+	return nBytes, f.Flush()
+}
+
+// Returns the dawg, and the encodings, written by writeDAWG as body,
+// which is used in place. As with an index only the layout is checked;
+// an edge out of range, or not leading forward, is taken as missing.
+// Errors are DictErrors, at offsets from base
+func openDAWG(body []byte, base int64) (*dawg, []bits, error) {
+	if len(body) < 12 {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	ncodes, nstates, nedges := int64(u32(body, 0)), int64(u32(body, 1)), int64(u32(body, 2))
+	size := 12 + 4*ncodes + 4*(nstates+1) + 4*nstates + 5*nedges
+	if int64(len(body)) < size {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	if int64(len(body)) > size || nstates == 0 {
+		return nil, nil, dictError(base, "", ErrBadEntry)
+	}
+	encodes := make([]bits, ncodes)
+	for i := range encodes {
+		encodes[i] = bits(u32(body, 3+i))
+	}
+	p := 12 + 4*ncodes
+	next := func(n int64) []byte {
+		b := body[p : p+n : p+n]
+		p += n
+		return b
+	}
+	d := &dawg{start: next(4 * (nstates + 1)), final: next(4 * nstates), target: next(4 * nedges), labels: next(nedges)}
+	return d, encodes, nil
+}
+
+// Passes the words of d, and the indexes of their encodings, in order
+// to add, checking the codes. Errors are DictErrors, at offset base
+func scanDAWG(d *dawg, ncodes int, base int64, add func(word []byte, i int)) error {
+	var err error
+	d.prefix(nil, func(word []byte, i int) bool {
+		if i >= ncodes {
+			err = dictError(base, string(word), ErrBadCode)
+			return false
+		}
+		add(word, i)
+		return true
+	})
+	return err
+}
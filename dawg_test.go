@@ -0,0 +1,252 @@
+package spell
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Returns the words of list and the dawg of them, read back from a
+// dictionary file
+func testDAWG(t testing.TB, list string) (*dawg, []dict, []bits) {
+	data, words, encodes := testDictFile(t, Metadata{Version: dawgVersion}, list)
+	md, body, base, err := parseDict(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, encodes, err := openDAWG(body, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Words != len(words) || md.Codes != len(encodes) {
+		t.Fatalf("metadata counts %d words, %d codes, want %d and %d", md.Words, md.Codes, len(words), len(encodes))
+	}
+	return d, words, encodes
+}
+
+func TestDAWG(t *testing.T) {
+	d, words, encodes := testDAWG(t, testList(t, amspellPaths...))
+	x, _, _ := testIndex(t, testList(t, amspellPaths...))
+	for _, word := range words {
+		for _, w := range []string{word.word, word.word + "s", word.word[1:], word.word[:len(word.word)-1]} {
+			i, j := d.lookup([]byte(w)), x.lookup([]byte(w))
+			if (i < 0) != (j < 0) || i >= 0 && encodes[i] != encodes[j] {
+				t.Fatalf("lookup(%q) = %d, index lookup %d", w, i, j)
+			}
+		}
+	}
+	for _, w := range []string{"", "\x00", "zzzz", "ü"} {
+		if i := d.lookup([]byte(w)); i >= 0 {
+			t.Errorf("lookup(%q) = %d, want -1", w, i)
+		}
+	}
+
+	var got []string
+	d.prefix(nil, func(word []byte, i int) bool {
+		got = append(got, string(word))
+		return true
+	})
+	want := make([]string, len(words))
+	for k, word := range words {
+		want[k] = word.word
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %d words, want %d", len(got), len(want))
+	}
+}
+
+func TestDAWGReadDict(t *testing.T) {
+	list := "a\tn\nab\tn\nabs\tv\nb\tn\ncab\tn\ncabs\tv\ncafé\tn\n"
+	compact, _, _ := testDictFile(t, Metadata{}, list)
+	data, _, _ := testDictFile(t, Metadata{Version: dawgVersion}, list)
+	_, want, wantEncodes, err := readDict(bytes.NewReader(compact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, gotEncodes, err := readDict(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(gotEncodes, wantEncodes) {
+		t.Errorf("read %v %v, want %v %v", got, gotEncodes, want, wantEncodes)
+	}
+}
+
+func TestDAWGBadEdges(t *testing.T) {
+	var b dawgBuilder
+	b.add([]byte("ab"), 0)
+	d := b.build()
+	if d.lookup([]byte("ab")) != 0 {
+		t.Fatal("lookup(ab) failed")
+	}
+	// Make the edge from the start lead back to it
+	d.target = appendUint32(nil, 0)
+	d.target = append(d.target, appendUint32(nil, 2)...)
+	if i := d.lookup([]byte("aab")); i >= 0 {
+		t.Errorf("lookup through a backward edge = %d", i)
+	}
+	d.prefix(nil, func(word []byte, i int) bool {
+		t.Errorf("listed %q through a backward edge", word)
+		return true
+	})
+}
+
+func TestComplete(t *testing.T) {
+	for _, c := range []*Checker{american(t), openTestDAWG(t)} {
+		got, err := c.Complete("read", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 || !sort.StringsAreSorted(got) {
+			t.Errorf("Complete(read) = %q", got)
+		}
+		for _, w := range got {
+			if !strings.HasPrefix(w, "read") || !c.Check(w) {
+				t.Errorf("Complete(read) gave %q", w)
+			}
+		}
+		if got, _ := c.Complete("a", 3); len(got) != 3 {
+			t.Errorf("Complete(a, 3) = %q", got)
+		}
+	}
+	c, _, _ := hashedChecker(t, 1e-3)
+	if _, err := c.Complete("a", 1); err == nil {
+		t.Error("Complete on a hashed list succeeded")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	for _, c := range []*Checker{american(t), openTestDAWG(t)} {
+		got, err := c.Suggest("acident", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 || got[0] != "accident" {
+			t.Errorf("Suggest(acident, 1) = %q", got)
+		}
+		got, _ = c.Suggest("seperat", 2)
+		found := false
+		for _, w := range got {
+			found = found || w == "separate"
+		}
+		if !found {
+			t.Errorf("Suggest(seperat, 2) = %q, want separate", got)
+		}
+		if got, _ := c.Suggest("accident", 0); !reflect.DeepEqual(got, []string{"accident"}) {
+			t.Errorf("Suggest(accident, 0) = %q", got)
+		}
+	}
+}
+
+func TestFuzzyUTF8(t *testing.T) {
+	d, _, _ := testDAWG(t, "café\tn\ncafe\tn\ncafés\tn\ncat\tn\n")
+	var got []string
+	d.fuzzy([]byte("cafè"), 1, func(word []byte, i, edits int) {
+		got = append(got, fmt.Sprintf("%s %d", word, edits))
+	})
+	want := []string{"cafe 1", "café 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fuzzy(cafè, 1) = %q, want %q", got, want)
+	}
+}
+
+// Returns the embedded American Checker, which is indexed
+func american(t testing.TB) *Checker {
+	c, err := American()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Returns a Checker for the amspell lists compiled as an automaton
+func openTestDAWG(t *testing.T) *Checker {
+	list := testList(t, amspellPaths...)
+	d, _, _ := testDAWG(t, list)
+	data, _, _ := testDictFile(t, Metadata{Version: dawgVersion}, list)
+	path := filepath.Join(t.TempDir(), "amspell.dawg")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if c.words.(*dawg).len() != d.len() {
+		t.Errorf("opened %d states, want %d", c.words.(*dawg).len(), d.len())
+	}
+	return c
+}
+
+// Returns the words of web2, the second edition of Webster's, each given
+// the code n since the list has none
+func web2List(b *testing.B) string {
+	data, err := os.ReadFile("benchmark/dict/web2")
+	if err != nil {
+		b.Skip(err)
+	}
+	return strings.ReplaceAll(string(data), "\n", "\tn\n")
+}
+
+// Compares the size and lookup time of each format on dictionaries/list
+// and web2. The file sizes are reported as bytes/word
+func BenchmarkFormats(b *testing.B) {
+	lists := []struct {
+		name string
+		text func(b *testing.B) string
+	}{
+		{"list", func(b *testing.B) string {
+			data, err := os.ReadFile("dictionaries/list")
+			if err != nil {
+				b.Fatal(err)
+			}
+			return string(data)
+		}},
+		{"web2", web2List},
+	}
+	formats := []struct {
+		name string
+		md   Metadata
+	}{
+		{"compact", Metadata{}},
+		{"index", Metadata{Version: indexVersion}},
+		{"hash", Metadata{Version: hashVersion, FalseRate: 1e-5}},
+		{"dawg", Metadata{Version: dawgVersion}},
+	}
+	for _, l := range lists {
+		for _, f := range formats {
+			b.Run(l.name+"/"+f.name, func(b *testing.B) {
+				data, words, _ := testDictFile(b, f.md, l.text(b))
+				c, err := NewChecker(bytes.NewReader(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				ws := benchWords(words)
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					c.words.lookup(ws[n%len(ws)])
+				}
+				b.ReportMetric(float64(len(data))/float64(len(words)), "bytes/word")
+			})
+		}
+	}
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	c := american(b)
+	if _, err := c.automaton(); err != nil {
+		b.Fatal(err)
+	}
+	ws := []string{"acident", "seperat", "recieve", "wierd", "untill"}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		c.Suggest(ws[n%len(ws)], 2)
+	}
+}
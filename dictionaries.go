@@ -0,0 +1,54 @@
+package spell
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:generate sh -c "cd dictionaries && go run ../cmd/pcode -variant american list american local stop > amspell"
+//go:generate sh -c "cd dictionaries && go run ../cmd/pcode -variant british list british local stop > brspell"
+
+// Spelling lists compiled by pcode from the annotated lists in
+// dictionaries, and the default affix rules
+//
+//go:embed dictionaries/amspell dictionaries/brspell dictionaries/rules
+var dictionaries embed.FS
+
+// American returns a Checker for the American spelling list built into
+// the package
+func American() (*Checker, error) {
+	return OpenFS(dictionaries, "dictionaries/amspell")
+}
+
+// British returns a Checker for the British spelling list built into
+// the package, which also takes -ise in place of -ize (realise)
+func British() (*Checker, error) {
+	c, err := OpenFS(dictionaries, "dictionaries/brspell")
+	if err != nil {
+		return nil, err
+	}
+	c.ise()
+	return c, nil
+}
+
+// Switches the suffix rules of c to British spelling
+func (c *Checker) ise() {
+	c.british = true
+	c.suf = ise(c.suf)
+}
+
+// Returns the suffix rules suf with z replaced by s in the suffixes and
+// their derivations (-ize, -ization -> -ise, -isation)
+func ise(suf []suffix) []suffix {
+	suf = append([]suffix(nil), suf...)
+	for i := range suf {
+		suf[i].s = ztos(suf[i].s)
+		suf[i].d1 = ztos(suf[i].d1)
+		suf[i].a1 = ztos(suf[i].a1)
+	}
+	return suf
+}
+
+func ztos(s string) string {
+	return strings.ReplaceAll(s, "z", "s")
+}
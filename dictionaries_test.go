@@ -0,0 +1,64 @@
+package spell
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// The built-in lists must be regenerated (go generate) when the
+// annotated lists change
+func TestDictionariesUpToDate(t *testing.T) {
+	for name, paths := range map[string][]string{
+		"dictionaries/amspell": amspellPaths,
+		"dictionaries/brspell": {"dictionaries/list", "dictionaries/british", "dictionaries/local", "dictionaries/stop"},
+	} {
+		list, _, _ := testDictFile(t, Metadata{}, testList(t, paths...))
+		_, want, wantEncodes, err := readDict(bytes.NewReader(list))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := dictionaries.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		md, got, gotEncodes, err := readDict(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if md.Version != dictVersion || !reflect.DeepEqual(got, want) || !reflect.DeepEqual(gotEncodes, wantEncodes) {
+			t.Errorf("%s is out of date; run go generate", name)
+		}
+	}
+}
+
+func TestBritish(t *testing.T) {
+	am, err := American()
+	if err != nil {
+		t.Fatal(err)
+	}
+	br, err := British()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		word   string
+		am, br bool
+	}{
+		{"color", true, false},
+		{"colour", false, true},
+		{"realize", true, false},
+		{"realise", false, true},
+		{"organization", true, false},
+		{"organisation", false, true},
+		{"happiness", true, true},
+	}
+	for _, test := range tests {
+		if ok := am.Check(test.word); ok != test.am {
+			t.Errorf("American %s: got %v, want %v", test.word, ok, test.am)
+		}
+		if ok := br.Check(test.word); ok != test.br {
+			t.Errorf("British %s: got %v, want %v", test.word, ok, test.br)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package spell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Problems found in compiled dictionaries, wrapped in a DictError
+var (
+	ErrTruncated = errors.New("dictionary truncated")
+	ErrBadEntry  = errors.New("malformed dictionary entry")
+	ErrBadCode   = errors.New("affix code index out of range")
+	ErrUnsorted  = errors.New("dictionary not sorted")
+	ErrVersion   = errors.New("unsupported dictionary version")
+	ErrChecksum  = errors.New("dictionary checksum mismatch")
+	ErrMetadata  = errors.New("bad dictionary metadata")
+	ErrHashed    = errors.New("hashed dictionary holds no words")
+)
+
+// ErrLegacy is returned when a dictionary does not fit the legacy layout
+var ErrLegacy = errors.New("dictionary does not fit the legacy layout")
+
+// DictError reports a problem at a byte offset of a compiled dictionary.
+// Use errors.Is to test for ErrTruncated, ErrBadEntry and so on
+type DictError struct {
+	Offset int64  // offset of the entry (or header) at fault
+	Word   string // word of the entry, or of the one before it
+	Err    error
+}
+
+func (e *DictError) Error() string {
+	if e.Word == "" {
+		return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%v at offset %d (%q)", e.Err, e.Offset, e.Word)
+}
+
+func (e *DictError) Unwrap() error {
+	return e.Err
+}
+
+// Returns a DictError for err at off. A short read is ErrTruncated
+func dictError(off int64, word string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &DictError{Offset: off, Word: word, Err: err}
+}
+
+// Problems found in annotated spelling lists, wrapped in a ListError
+var (
+	ErrFields    = errors.New("expected a word and its affix codes")
+	ErrWordChar  = errors.New("invalid character in word")
+	ErrAffixCode = errors.New("unknown affix code")
+)
+
+// Problems found in Hunspell affix files, wrapped in a ListError
+var (
+	ErrAffixLine     = errors.New("malformed affix rule")
+	ErrAffixEncoding = errors.New("unsupported affix file encoding")
+)
+
+// ListError reports a problem at a line of an annotated spelling list,
+// or of a Hunspell dictionary.
+// Use errors.Is to test for ErrFields, ErrWordChar, ErrAffixCode,
+// ErrAffixLine and ErrAffixEncoding
+type ListError struct {
+	File string // name of the list
+	Line int
+	Err  error
+}
+
+func (e *ListError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ListError) Unwrap() error {
+	return e.Err
+}
+
+// Problems found in rule files, wrapped in a RuleError, besides
+// ErrAffixCode. Those after ErrRuleOp are found by LintRules
+var (
+	ErrRuleFields   = errors.New("expected a suffix or prefix rule")
+	ErrRuleOp       = errors.New("unknown suffix op")
+	ErrRuleOrder    = errors.New("rule out of order")
+	ErrRuleShadowed = errors.New("rule never tried")
+	ErrRuleBlocker  = errors.New("blocker blocks nothing")
+	ErrRuleMask     = errors.New("affix classes never match")
+)
+
+// RuleError reports a problem at a line of a rule file. Use errors.Is to
+// test for ErrRuleFields, ErrRuleOp, ErrAffixCode and so on
+type RuleError struct {
+	File string // name of the rule file
+	Line int
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
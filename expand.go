@@ -0,0 +1,206 @@
+package spell
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A Form is a word derived from a stem, and its derivation as spell -v
+// prints it: -y+iness for happiness, un+re+d for unrecognized
+type Form struct {
+	Word, Affix string
+}
+
+// Expand returns, in order, the forms c would accept were entry, a line
+// of an annotated list such as "happy a", added to its spelling list:
+// those derived from the word with up to nsuf suffixes and npref
+// prefixes, with their derivations, less the words on the stop list.
+// The word itself is not returned. A bad entry is an error as in a list
+func (c *Checker) Expand(entry string, nsuf, npref int) ([]Form, error) {
+	word, code, err := parseEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	forms := make([]Form, 0)
+	for _, f := range c.expand(word, code, nsuf, npref) {
+		if !isSet(c.lookup([]byte(f.Word)), STOP) {
+			forms = append(forms, f)
+		}
+	}
+	return forms, nil
+}
+
+// Returns, in order, the forms c derives from stem as though it were
+// the only word of the spelling list, with the affix classes code: the
+// forms with up to nsuf suffixes (nation+al+ize), and those with up to
+// npref prefixes. Candidates are made by undoing the rules of c, adding
+// each suffix or the ending its derivation records, and kept if c's
+// rules derive them from stem. A stop list stem derives nothing
+func (c *Checker) expand(stem string, code bits, nsuf, npref int) []Form {
+	if stem == "" || isSet(code, STOP) {
+		return nil
+	}
+	dict := func(w []byte) bits {
+		if string(w) == stem {
+			return code
+		}
+		return 0
+	}
+	tried := map[string]bool{stem: true}
+	var forms []Form
+	try := func(w string) bool {
+		if tried[w] {
+			return false
+		}
+		tried[w] = true
+		q := newQuery(w, dict)
+		q.suf, q.pref = c.suf, c.pref
+		if h := q.check(); h == 0 || isSet(h, STOP) {
+			return false
+		}
+		forms = append(forms, Form{w, q.affix})
+		return true
+	}
+
+	// a form and the classes it may be looked up as to take a suffix
+	type form struct {
+		word string
+		as   bits
+	}
+	level := []form{{stem, code}}
+	for n := 0; n < nsuf && len(level) > 0; n++ {
+		var next []form
+		for _, f := range level {
+			for i := range c.suf {
+				t := &c.suf[i]
+				if t.blocker() || !isSet(f.as, t.flag) {
+					continue
+				}
+				for _, w := range suffixCandidates(f.word, t) {
+					if try(w) {
+						next = append(next, form{w, c.suffixOf(w)})
+					}
+				}
+			}
+		}
+		level = next
+	}
+
+	words := []string{stem}
+	for _, f := range forms {
+		words = append(words, f.Word)
+	}
+	for n := 0; n < npref && !isSet(code, NOPREF); n++ {
+		var next []string
+		for _, w := range words {
+			for _, p := range c.pref {
+				if try(p.s + w) {
+					next = append(next, p.s+w)
+				}
+			}
+		}
+		words = next
+	}
+	sort.Slice(forms, func(i, j int) bool { return forms[i].Word < forms[j].Word })
+	return forms
+}
+
+// Returns the words the suffix rule t might derive from b: b with the
+// suffix, or the ending a derivation of t records (-y+iness), added,
+// allowing for a doubled final consonant or a dropped final letter
+func suffixCandidates(b string, t *suffix) []string {
+	last := b[len(b)-1:]
+	words := []string{b + t.s, b + last + t.s, b[:len(b)-1] + t.s}
+	for _, d := range []string{t.d1, t.a1, t.d2, t.a2} {
+		del, add := "", d
+		if k := strings.IndexByte(d, '+'); k >= 0 {
+			del, add = strings.TrimPrefix(d[:k], "-"), d[k+1:]
+		}
+		if add == "" || !strings.HasSuffix(b, del) {
+			continue
+		}
+		words = append(words, b[:len(b)-len(del)]+add)
+		if del == "" {
+			words = append(words, b+last+add)
+		}
+	}
+	return words
+}
+
+// Returns the classes w may be looked up as when a further suffix is
+// stripped from it: those of the first suffix rule matching its end and
+// leaving a vowel, which is the only one trysuff tries
+func (c *Checker) suffixOf(w string) bits {
+	for i := range c.suf {
+		t := &c.suf[i]
+		if !strings.HasSuffix(w, t.s) {
+			continue
+		}
+		if !hasVowel([]byte(stemOf(w, t.n1))) {
+			continue
+		}
+		return t.affixable
+	}
+	return 0
+}
+
+// main function for derive. Prints each entry of the annotated lists
+// named by the arguments, or standard input, followed by the forms the
+// spelling list would take were it added, indented, with derivations
+func Derive() {
+	f := flag.String("f", "", "Path to encoded spell dictionary file (created with pcode). Defaults to the built-in American or British list")
+	b := flag.Bool("b", false, "British spelling: derive by the British rules, taking -ise for -ize")
+	r := flag.String("r", "", "Path to a file of affix rules to derive words by. Defaults to the built-in rules of v10spell (dictionaries/rules)")
+	nsuf := flag.Int("s", 1, "Derive forms with up to this many suffixes (walk+ed+ness)")
+	npref := flag.Int("p", 0, "Derive forms with up to this many prefixes")
+	n := flag.Bool("n", false, "Print only the forms the spelling list does not already take")
+	flag.Parse()
+
+	c, err := openChecker(*f, *b, *r)
+	if err != nil {
+		fatalf("derive: %v\n", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	derive := func(name string, in io.Reader) {
+		s := bufio.NewScanner(in)
+		for line := 1; s.Scan(); line++ {
+			entry := strings.TrimSpace(s.Text())
+			if entry == "" || entry[0] == '#' {
+				continue
+			}
+			forms, err := c.Expand(entry, *nsuf, *npref)
+			if err != nil {
+				out.Flush()
+				fatalf("derive: %v\n", &ListError{File: name, Line: line, Err: err})
+			}
+			fmt.Fprintln(out, strings.Join(strings.Fields(entry), "\t"))
+			for _, form := range forms {
+				if !*n || !c.Check(form.Word) {
+					fmt.Fprintf(out, "\t%s\t%s\n", form.Word, form.Affix)
+				}
+			}
+		}
+		if err := s.Err(); err != nil {
+			out.Flush()
+			fatalf("derive: %s: %v\n", name, err)
+		}
+	}
+	if flag.NArg() == 0 {
+		derive("standard input", os.Stdin)
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fatalf("cannot open %s\n", path)
+		}
+		derive(path, f)
+		f.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package spell
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	c := american(t)
+	forms, err := c.Expand("happy\ta", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Form{{"happily", "-y+ily"}, {"happiness", "-y+iness"}, {"happyism", "ism"},
+		{"happyist", "+ist"}, {"happyity", "+ity"}, {"happyize", "+ize"}}
+	if !reflect.DeepEqual(forms, want) {
+		t.Errorf("Expand(happy a) = %v, want %v", forms, want)
+	}
+
+	tests := []struct {
+		entry       string
+		nsuf, npref int
+		has, hasnt  []string
+	}{
+		{"fib n,v,er,ms", 1, 0, []string{"fibbing", "fibbed", "fibber", "fibs"}, []string{"fibing", "fib"}},
+		{"walk v", 2, 0, []string{"walkings"}, []string{"walkeding"}},
+		{"regular a,in", 1, 1, []string{"irregular", "irregularly", "nonregular"}, []string{"unregular", "inregular"}},
+		{"read v,er,va", 1, 2, []string{"unreadable", "rereading", "unrereadable"}, nil},
+		{"accident a", 1, 0, []string{"accidentness"}, []string{"accidently"}}, // on the stop list
+		{"Babylon pc,nopref", 1, 1, []string{"Babylonian"}, []string{"unBabylon"}},
+		{"thier s", 1, 1, nil, []string{"thiers"}},
+	}
+	for _, test := range tests {
+		forms, err := c.Expand(test.entry, test.nsuf, test.npref)
+		if err != nil {
+			t.Errorf("%s: %v", test.entry, err)
+			continue
+		}
+		found := make(map[string]bool)
+		for _, f := range forms {
+			found[f.Word] = true
+		}
+		for _, w := range test.has {
+			if !found[w] {
+				t.Errorf("%s: %s not derived", test.entry, w)
+			}
+		}
+		for _, w := range test.hasnt {
+			if found[w] {
+				t.Errorf("%s: %s derived", test.entry, w)
+			}
+		}
+	}
+
+	if _, err := c.Expand("happy aa", 1, 0); !errors.Is(err, ErrAffixCode) {
+		t.Errorf("Expand(happy aa) err = %v, want %v", err, ErrAffixCode)
+	}
+}
+
+// The forms derived from an entry are those a list of it alone takes
+func TestExpandChecks(t *testing.T) {
+	for _, entry := range []string{"realize\tv,comp,ion,va", "nation\tn,na", "able\ta,comp", "America\tpc"} {
+		c := testChecker(t, Metadata{}, entry+"\n")
+		forms, err := c.Expand(entry, 2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(forms) == 0 {
+			t.Errorf("%s derives nothing", entry)
+		}
+		for _, f := range forms {
+			q, h := c.query(f.Word)
+			if h == 0 || isSet(h, STOP) || q.affix != f.Affix {
+				t.Errorf("%s: %s (%s) is derived as %q, %s", entry, f.Word, f.Affix, q.affix, codeToStr(h))
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package spell
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Calls visit, in order, with each word of the spelling list of c and
+// its affix classes. Hashed lists hold no words
+func (c *Checker) stems(visit func(word string, code bits)) error {
+	d, err := c.automaton()
+	if err != nil {
+		return err
+	}
+	d.prefix(nil, func(word []byte, i int) bool {
+		if i < len(c.encodes) {
+			visit(string(word), c.encodes[i])
+		}
+		return true
+	})
+	return nil
+}
+
+// ExportWords writes to w, one per line and in order, the words of the
+// spelling list of c and the forms c derives from them with up to nsuf
+// suffixes and npref prefixes, leaving out those c rejects, such as
+// words on the stop list. Each prefix multiplies the list some fiftyfold
+func ExportWords(w io.Writer, c *Checker, nsuf, npref int) error {
+	words := make(map[string]bool)
+	err := c.stems(func(stem string, code bits) {
+		if c.Check(stem) {
+			words[stem] = true
+		}
+		for _, f := range c.expand(stem, code, nsuf, npref) {
+			if !words[f.Word] && c.Check(f.Word) {
+				words[f.Word] = true
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	sorted := make([]string, 0, len(words))
+	for word := range words {
+		sorted = append(sorted, word)
+	}
+	sort.Strings(sorted)
+	out := bufio.NewWriter(w)
+	for _, word := range sorted {
+		fmt.Fprintln(out, word)
+	}
+	return out.Flush()
+}
+
+// Flags of the exported Hunspell affix file. Suffix flags follow
+const (
+	hunForbidden = 1 + iota // stop list words
+	hunPrefix               // the prefixes of words not in the IN class
+	hunPrefixIN             // the prefixes of IN words
+	hunSuffix
+)
+
+// An ending change derives a form from a stem: strip, at the end of the
+// stem, is replaced by add. If cross is set the form takes prefixes
+type endingChange struct {
+	strip, add string
+	cross      bool
+}
+
+// ExportHunspell writes the spelling list of c as a Hunspell dictionary,
+// its affix file to aff and its words to dic. Each change of ending by
+// which c derives a form with up to nsuf suffixes from a word of the
+// list becomes a suffix flag of its own, so Hunspell derives the same
+// forms. The prefixes go on the words that take them, combining with
+// the suffixes whose forms take them, but only one at a time; Hunspell
+// cannot stack them as c does (un+re+read). Stop list words are
+// forbidden
+func ExportHunspell(aff, dic io.Writer, c *Checker, nsuf int) error {
+	type entry struct {
+		word    string
+		flags   []int
+		changes []endingChange
+	}
+	var entries []entry
+	uses := make(map[endingChange]int)
+	err := c.stems(func(stem string, code bits) {
+		e := entry{word: stem}
+		pref := "" // a prefix the stem takes, to try on its forms
+		switch {
+		case isSet(code, STOP):
+			entries = append(entries, entry{word: stem, flags: []int{hunForbidden}})
+			return
+		case isSet(code, NOPREF) || !hasVowel([]byte(stem)):
+		case isSet(code, IN):
+			e.flags = append(e.flags, hunPrefixIN)
+			pref = c.prefixFor(IN)
+		default:
+			e.flags = append(e.flags, hunPrefix)
+			pref = c.prefixFor(0)
+		}
+		for _, f := range c.expand(stem, code, nsuf, 0) {
+			if ch, ok := changeOf(stem, f.Word); ok && c.Check(f.Word) {
+				ch.cross = pref != "" && c.Check(pref+f.Word)
+				e.changes = append(e.changes, ch)
+				uses[ch]++
+			}
+		}
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Number the changes, most used first
+	changes := make([]endingChange, 0, len(uses))
+	for ch := range uses {
+		changes = append(changes, ch)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if uses[a] != uses[b] {
+			return uses[a] > uses[b]
+		}
+		if a.strip != b.strip {
+			return a.strip < b.strip
+		}
+		if a.add != b.add {
+			return a.add < b.add
+		}
+		return a.cross && !b.cross
+	})
+	flags := make(map[endingChange]int, len(changes))
+	for k, ch := range changes {
+		flags[ch] = hunSuffix + k
+	}
+
+	out := bufio.NewWriter(aff)
+	fmt.Fprintf(out, "# Exported from a spelling list compiled by pcode. Each suffix flag\n")
+	fmt.Fprintf(out, "# changes the ending of the words it is on in one way\n")
+	fmt.Fprintf(out, "SET UTF-8\nFLAG num\nFORBIDDENWORD %d\n", hunForbidden)
+	for _, class := range []struct {
+		flag int
+		code bits
+	}{{hunPrefix, 0}, {hunPrefixIN, IN}} {
+		var rules []string
+		for _, p := range c.pref {
+			if cond := prefixCondition(p, class.code); cond != "" {
+				rules = append(rules, fmt.Sprintf("PFX %d 0 %s %s\n", class.flag, p.s, cond))
+			}
+		}
+		fmt.Fprintf(out, "\nPFX %d Y %d\n%s", class.flag, len(rules), strings.Join(rules, ""))
+	}
+	for _, ch := range changes {
+		strip, cond, cross := ch.strip, ch.strip, "N"
+		if strip == "" {
+			strip, cond = "0", "."
+		}
+		if ch.cross {
+			cross = "Y"
+		}
+		fmt.Fprintf(out, "\nSFX %d %s 1\nSFX %d %s %s %s\n", flags[ch], cross, flags[ch], strip, ch.add, cond)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	out = bufio.NewWriter(dic)
+	fmt.Fprintln(out, len(entries))
+	for _, e := range entries {
+		for _, ch := range e.changes {
+			e.flags = append(e.flags, flags[ch])
+		}
+		sort.Ints(e.flags)
+		out.WriteString(strings.ReplaceAll(e.word, "/", `\/`))
+		for k, fl := range e.flags {
+			if k == 0 {
+				out.WriteByte('/')
+			} else {
+				out.WriteByte(',')
+			}
+			out.WriteString(strconv.Itoa(fl))
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// Returns the change of ending deriving form from stem. Hunspell must
+// leave some of the stem, so forms sharing no beginning with it have none
+func changeOf(stem, form string) (endingChange, bool) {
+	k := 0
+	for k < len(stem) && k < len(form) && stem[k] == form[k] {
+		k++
+	}
+	for k > 0 && (k < len(stem) && !utf8.RuneStart(stem[k]) || k < len(form) && !utf8.RuneStart(form[k])) {
+		k--
+	}
+	if k == 0 {
+		return endingChange{}, false
+	}
+	return endingChange{strip: stem[k:], add: form[k:]}, true
+}
+
+// Returns a prefix that goes on any word of the affix classes code
+// with a vowel, or "" if there is none
+func (c *Checker) prefixFor(code bits) string {
+	for _, p := range c.pref {
+		if prefixCondition(p, code) == "." {
+			return p.s
+		}
+	}
+	return ""
+}
+
+// Returns the Hunspell condition on the beginning of words of the affix
+// classes code under which the prefix p applies: "." for any word, a
+// set of letters for an IN class prefix (in-, im-, ir- and un-) that
+// depends on the first letter, or "" if p never applies
+func prefixCondition(p prefix, code bits) string {
+	if !isSet(p.flag, IN) {
+		return "."
+	}
+	var in, out []byte
+	for c := byte('a'); c <= 'z'; c++ {
+		if inun(p.s, c, code) {
+			in = append(in, c)
+		} else {
+			out = append(out, c)
+		}
+	}
+	switch {
+	case len(in) == 0:
+		return ""
+	case len(out) == 0:
+		return "."
+	case len(in) <= len(out):
+		return "[" + string(in) + "]"
+	}
+	return "[^" + string(out) + "]"
+}
+
+// main function for spellexport. Writes the built-in list, one compiled
+// by pcode or the annotated lists named by the arguments as a flat word
+// list on standard output, or as a Hunspell dictionary
+func Spellexport() {
+	f := flag.String("f", "", "Path to encoded spell dictionary file (created with pcode). Defaults to the annotated lists named by the arguments, or the built-in American or British list")
+	b := flag.Bool("b", false, "British spelling: export the British list and take -ise for -ize")
+	r := flag.String("r", "", "Path to a file of affix rules to derive words by. Defaults to the built-in rules of v10spell (dictionaries/rules)")
+	nsuf := flag.Int("s", 1, "Derive forms with up to this many suffixes (walk+ed+ness)")
+	npref := flag.Int("p", 0, "Derive forms of the word list with up to this many prefixes")
+	hun := flag.String("hunspell", "", "Write a Hunspell dictionary, `base`.aff and base.dic, instead of a word list")
+	flag.Parse()
+
+	c, err := openChecker(*f, *b, *r, flag.Args()...)
+	if err != nil {
+		fatalf("spellexport: %v\n", err)
+	}
+
+	if *hun == "" {
+		if err := ExportWords(os.Stdout, c, *nsuf, *npref); err != nil {
+			fatalf("spellexport: %v\n", err)
+		}
+		return
+	}
+	aff, err := os.Create(*hun + ".aff")
+	if err != nil {
+		fatalf("spellexport: %v\n", err)
+	}
+	dic, err := os.Create(*hun + ".dic")
+	if err != nil {
+		fatalf("spellexport: %v\n", err)
+	}
+	err = ExportHunspell(aff, dic, c, *nsuf)
+	if err1 := aff.Close(); err == nil {
+		err = err1
+	}
+	if err1 := dic.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fatalf("spellexport: %v\n", err)
+	}
+}
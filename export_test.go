@@ -0,0 +1,88 @@
+package spell
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestExportWords(t *testing.T) {
+	c := testChecker(t, Metadata{}, "walk\tv\nthier\ts\nhappy\ta\n")
+	var out strings.Builder
+	if err := ExportWords(&out, c, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "happily\nhappiness\nhappy\nhappyism\nhappyist\nhappyity\nhappyize\nwalk\nwalked\nwalking\nwalks\n"
+	if out.String() != want {
+		t.Errorf("words =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := ExportWords(&out, c, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"unwalked", "rewalking", "unhappiness", "walkings"} {
+		if !strings.Contains(out.String(), "\n"+word+"\n") {
+			t.Errorf("%s not exported", word)
+		}
+	}
+	for _, word := range strings.Fields(out.String()) {
+		if !c.Check(word) {
+			t.Errorf("%s exported but rejected", word)
+		}
+	}
+}
+
+func TestExportHunspell(t *testing.T) {
+	c := testChecker(t, Metadata{}, "walk\tv\nfib\tn,v,er,ms\nthier\ts\nhappy\ta\nregular\ta,in\nAmerica\tpc\nAAA\tpc,nopref\n")
+	var aff, dic strings.Builder
+	if err := ExportHunspell(&aff, &dic, c, 1); err != nil {
+		t.Fatal(err)
+	}
+	a, err := readAffixFile("aff", strings.NewReader(aff.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words strings.Builder
+	if err := ExportWords(&words, c, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	derived := make(map[string]bool)
+	s := bufio.NewScanner(strings.NewReader(dic.String()))
+	s.Scan() // the count
+	forbidden := 0
+	for s.Scan() {
+		word, flagText := s.Text(), ""
+		if k := strings.IndexByte(word, '/'); k >= 0 {
+			word, flagText = word[:k], word[k+1:]
+		}
+		if flagText == a.forbidden {
+			forbidden++
+			continue
+		}
+		derived[word] = true
+		for _, form := range a.expand(word, a.splitFlags(flagText, true)) {
+			derived[form] = true
+			if !c.Check(form) {
+				t.Errorf("Hunspell derives %s from %s, which is rejected", form, s.Text())
+			}
+		}
+	}
+	if forbidden != 1 {
+		t.Errorf("%d forbidden words, want 1 (thier)", forbidden)
+	}
+	for _, word := range strings.Fields(words.String()) {
+		if !derived[word] {
+			t.Errorf("Hunspell does not derive %s", word)
+		}
+	}
+	for _, word := range []string{"unwalked", "irregularly", "fibbing", "American"} {
+		if !derived[word] {
+			t.Errorf("Hunspell does not derive %s", word)
+		}
+	}
+	if derived["unAmerican"] || derived["unAAA"] {
+		t.Errorf("Hunspell derives prefixed forms of proper names")
+	}
+}
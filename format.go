@@ -0,0 +1,432 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A dictionary file wraps a list of entries with a header, metadata
+// and checksum. All fixed-size numbers are big-endian.
+//
+//	struct {
+//	  magic    [4]byte  // "\x89spl"
+//	  version  uint16
+//	  nmeta    uint32
+//	  meta     [nmeta]byte // "key: value" lines, see Metadata
+//	  dict     []byte      // see writeEntries
+//	  checksum uint32      // CRC-32 (IEEE) of all the preceding bytes
+//	}
+//
+// Version 2 files, written by default, hold the entries written by
+// writeEntries as dict, and version 1 files the legacy layout written
+// by writeDict. Version 3 files hold the index written by writeIndex,
+// which is larger but is looked up in place, version 4 files the hashes
+// written by writeHashed, which are smaller but hold no words, and
+// version 5 files the automaton written by writeDAWG, which is looked
+// up in place and can list the words. Legacy files, which have no
+// header, hold only the layout of writeDict. They cannot be mistaken
+// for the above since a code count starting with 0x89 would exceed 2048.
+const (
+	dictMagic    = "\x89spl"
+	dictVersion  = 2 // written unless an index is asked for
+	indexVersion = 3
+	hashVersion  = 4
+	dawgVersion  = 5
+)
+
+// Metadata describes a compiled dictionary
+type Metadata struct {
+	Version  int       // file format version, 0 for legacy files
+	Language string    // language of the words, e.g. en
+	Variant  string    // e.g. american, british
+	Sources  []string  // annotated lists compiled into the dictionary
+	Built    time.Time // when the dictionary was compiled
+	Words    int       // number of words
+	Codes    int       // number of distinct affix codes
+
+	// FalseRate is, for hashed dictionaries, the chance that a word not
+	// in the list is accepted
+	FalseRate float64
+}
+
+// Returns the metadata block of a dictionary file
+func (md *Metadata) marshal() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "language: %s\n", md.Language)
+	fmt.Fprintf(&b, "variant: %s\n", md.Variant)
+	for _, source := range md.Sources {
+		fmt.Fprintf(&b, "source: %s\n", source)
+	}
+	if !md.Built.IsZero() {
+		fmt.Fprintf(&b, "built: %s\n", md.Built.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "words: %d\n", md.Words)
+	fmt.Fprintf(&b, "codes: %d\n", md.Codes)
+	if md.FalseRate != 0 {
+		fmt.Fprintf(&b, "false-rate: %g\n", md.FalseRate)
+	}
+	return b.Bytes()
+}
+
+// Parses the metadata block of a dictionary file. Unknown keys are
+// ignored so that later versions may add some
+func (md *Metadata) unmarshal(data []byte) error {
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			return fmt.Errorf("bad metadata line %q", line)
+		}
+		key, value := line[:i], line[i+2:]
+		var err error
+		switch key {
+		case "language":
+			md.Language = value
+		case "variant":
+			md.Variant = value
+		case "source":
+			md.Sources = append(md.Sources, value)
+		case "built":
+			md.Built, err = time.Parse(time.RFC3339, value)
+		case "words":
+			md.Words, err = strconv.Atoi(value)
+		case "codes":
+			md.Codes, err = strconv.Atoi(value)
+		case "false-rate":
+			md.FalseRate, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("bad metadata line %q: %v", line, err)
+		}
+	}
+	return nil
+}
+
+// Writes the dictionary file for words and encodes to w, filling in
+// the counts of md. The file is indexed if md.Version is indexVersion,
+// hashed with md.FalseRate if it is hashVersion, an automaton if it is
+// dawgVersion, else it is of dictVersion. Returns the number of bytes
+// written
+func writeDictFile(md Metadata, words []dict, encodes []bits, w io.Writer) (int, error) {
+	var body bytes.Buffer
+	var err error
+	nwords := len(words)
+	switch md.Version {
+	case indexVersion:
+		_, err = writeIndex(words, encodes, &body)
+	case hashVersion:
+		if !(md.FalseRate > 0 && md.FalseRate < 1) {
+			return 0, fmt.Errorf("false acceptance rate %g is not between 0 and 1", md.FalseRate)
+		}
+		modulus := hashRange(len(words), md.FalseRate)
+		var entries []hashEntry
+		entries, encodes = hashWords(words, encodes, modulus)
+		_, err = writeHashed(entries, encodes, modulus, &body)
+		nwords = len(entries)
+	case dawgVersion:
+		_, err = writeDAWG(words, encodes, &body)
+		for k := 1; k < len(words); k++ { // sorted by writeDAWG
+			if words[k].word == words[k-1].word {
+				nwords--
+			}
+		}
+	default:
+		md.Version = dictVersion
+		_, err = writeEntries(words, encodes, &body)
+	}
+	if err != nil {
+		return 0, err
+	}
+	md.Words, md.Codes = nwords, len(encodes)
+	meta := md.marshal()
+
+	crc := crc32.NewIEEE()
+	f := bufio.NewWriter(io.MultiWriter(w, crc))
+	f.WriteString(dictMagic)
+	sput(f, uint16(md.Version))
+	lput(f, uint32(len(meta)))
+	f.Write(meta)
+	f.Write(body.Bytes())
+	if err := f.Flush(); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(w, binary.BigEndian, crc.Sum32()); err != nil {
+		return 0, err
+	}
+	return len(dictMagic) + 2 + 4 + len(meta) + body.Len() + 4, nil
+}
+
+// Returns the metadata, words and encodings of the dictionary file, or
+// legacy dictionary, read from rd. Errors are DictErrors
+func readDict(rd io.Reader) (Metadata, []dict, []bits, error) {
+	var words []dict
+	md, encodes, err := scanDict(rd, func(word []byte, i int) {
+		words = append(words, dict{i: i, word: string(word)})
+	})
+	if err != nil {
+		return md, nil, nil, err
+	}
+	return md, words, encodes, nil
+}
+
+// Reads the dictionary file, or legacy dictionary, from rd, passing
+// each word and the index of its encoding to add as decodeDict does.
+// Returns the metadata and encodings. Errors are DictErrors
+func scanDict(rd io.Reader, add func(word []byte, i int)) (Metadata, []bits, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+	md, body, base, err := parseDict(data, true)
+	if err != nil {
+		return md, nil, err
+	}
+	encodes, err := decodeBody(&md, body, base, add)
+	return md, encodes, err
+}
+
+// Returns the metadata and body of the dictionary file, or legacy
+// dictionary, data, and the offset of the body in data. The checksum of
+// lists used in place is only checked if verify is set, as checking it
+// reads the whole file. Errors are DictErrors
+func parseDict(data []byte, verify bool) (Metadata, []byte, int64, error) {
+	var md Metadata
+	if !bytes.HasPrefix(data, []byte(dictMagic)) {
+		return md, data, 0, nil
+	}
+	const head = len(dictMagic) + 2 + 4
+	if len(data) < head+4 {
+		return md, nil, 0, dictError(0, "", ErrTruncated)
+	}
+	md.Version = int(binary.BigEndian.Uint16(data[len(dictMagic):]))
+	if md.Version < 1 || md.Version > dawgVersion {
+		return md, nil, 0, dictError(int64(len(dictMagic)), "", ErrVersion)
+	}
+	n := int(binary.BigEndian.Uint32(data[len(dictMagic)+2:]))
+	if n > len(data)-head-4 {
+		return md, nil, 0, dictError(int64(len(dictMagic)+2), "", ErrTruncated)
+	}
+	sum := binary.BigEndian.Uint32(data[len(data)-4:])
+	if (verify || !inPlace(md.Version)) && crc32.ChecksumIEEE(data[:len(data)-4]) != sum {
+		return md, nil, 0, dictError(int64(len(data)-4), "", ErrChecksum)
+	}
+	if err := md.unmarshal(data[head : head+n]); err != nil {
+		return md, nil, 0, dictError(int64(head), "", fmt.Errorf("%w: %v", ErrMetadata, err))
+	}
+	return md, data[head+n : len(data)-4], int64(head + n), nil
+}
+
+// Reports whether lists of the format version are looked up in place
+// (indexed, hashed and automaton lists) rather than decoded
+func inPlace(version int) bool {
+	return version == indexVersion || version == hashVersion || version == dawgVersion
+}
+
+// Decodes the body, at offset base, of a dictionary file of md, passing
+// each word and the index of its encoding to add as decodeDict does.
+// Fills in the counts of md and returns the encodings. Errors are
+// DictErrors
+func decodeBody(md *Metadata, body []byte, base int64, add func(word []byte, i int)) ([]bits, error) {
+	nwords := 0
+	count := func(word []byte, i int) {
+		add(word, i)
+		nwords++
+	}
+	var encodes []bits
+	var err error
+	switch md.Version {
+	case hashVersion:
+		return nil, dictError(base, "", ErrHashed)
+	case indexVersion:
+		var x *index
+		if x, encodes, err = openIndex(body, base); err == nil {
+			err = scanIndex(x, len(encodes), base, count)
+		}
+	case dawgVersion:
+		var d *dawg
+		if d, encodes, err = openDAWG(body, base); err == nil {
+			err = scanDAWG(d, len(encodes), base, count)
+		}
+	case dictVersion:
+		encodes, err = decodeEntries(bytes.NewReader(body), count)
+	default:
+		encodes, err = decodeDict(bytes.NewReader(body), count)
+	}
+	var de *DictError
+	if md.Version != indexVersion && md.Version != dawgVersion && errors.As(err, &de) {
+		de.Offset += base
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := md.checkCounts(nwords, len(encodes), base); err != nil {
+		return nil, err
+	}
+	return encodes, nil
+}
+
+// Returns an error if the counts of md, from a dictionary file, are not
+// nwords and ncodes, which it then holds. base is the offset of the body
+func (md *Metadata) checkCounts(nwords, ncodes int, base int64) error {
+	if md.Version != 0 && (md.Words != nwords || md.Codes != ncodes) {
+		return dictError(base, "", fmt.Errorf("%w: %d words and %d codes, found %d and %d",
+			ErrMetadata, md.Words, md.Codes, nwords, ncodes))
+	}
+	md.Words, md.Codes = nwords, ncodes
+	return nil
+}
+
+// Writes the sorted entries of words, after the affix codes, to w.
+// Unlike the legacy layout of writeDict there is no limit on the
+// number of codes, the shared prefix or the bytes of a word.
+//
+//	struct {
+//	  ncodes  uvarint
+//	  encodes [ncodes]uint32
+//	  []struct {
+//	    head   uvarint // prefix<<4 | min(n, 15)
+//	    more   uvarint // n-15, only if n >= 15
+//	    code   uvarint // index into encodes
+//	    rest   [n]byte // the rest of the word
+//	  }
+//	}
+//
+// where prefix is the count of bytes common with the previous word. Most
+// entries thus take a byte for the head and one or two for the code, near
+// the two bytes of the legacy layout.
+//
+// Returns the number of bytes written
+func writeEntries(words []dict, encodes []bits, w io.Writer) (int, error) {
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].word < words[j].word
+	})
+
+	f := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	uvarint := func(x int) int {
+		n, _ := f.Write(buf[:binary.PutUvarint(buf, uint64(x))])
+		return n
+	}
+	nBytes := uvarint(len(encodes))
+	for _, c := range encodes {
+		lput(f, uint32(c))
+		nBytes += 4
+	}
+
+	last := ""
+	for _, word := range words {
+		var j int
+		for j = 0; j < len(word.word) && j < len(last) && word.word[j] == last[j]; j++ {
+		}
+		n := len(word.word) - j
+		if n < entryLong {
+			nBytes += uvarint(j<<4 | n)
+		} else {
+			nBytes += uvarint(j<<4|entryLong) + uvarint(n-entryLong)
+		}
+		nBytes += uvarint(word.i)
+		n, _ = f.WriteString(word.word[j:])
+		nBytes += n
+		last = word.word
+	}
+	return nBytes, f.Flush()
+}
+
+// The length in an entry head from which the rest of the length follows
+const entryLong = 15
+
+// Returns the encodings given the output of writeEntries, passing
+// each word and the index of its encoding to add as decodeDict does.
+// Errors are DictErrors
+func decodeEntries(rd io.Reader, add func(word []byte, i int)) ([]bits, error) {
+	r := &countReader{r: bufio.NewReader(rd)}
+
+	ncodes, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, dictError(0, "", err)
+	}
+	if ncodes > math.MaxInt32 {
+		return nil, dictError(0, "", ErrBadEntry)
+	}
+	var encodes []bits
+	for i := uint64(0); i < ncodes; i++ {
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, dictError(r.n, "", err)
+		}
+		encodes = append(encodes, bits(binary.BigEndian.Uint32(b[:])))
+	}
+
+	var word, last []byte // this word and the previous one
+	for {
+		off := r.n
+		head, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, dictError(off, string(last), err)
+		}
+		j, n := head>>4, head&entryLong
+		if n == entryLong {
+			more, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, dictError(off, string(last), err)
+			}
+			n += more
+		}
+		i, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, dictError(off, string(last), err)
+		}
+		if j > uint64(len(last)) || n > math.MaxInt32 {
+			return nil, dictError(off, string(last), ErrBadEntry)
+		}
+		word = append(word[:0], last[:j]...)
+		for ; n > 0; n-- {
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, dictError(off, string(last), err)
+			}
+			word = append(word, c)
+		}
+		if i >= uint64(len(encodes)) {
+			return nil, dictError(off, string(word), ErrBadCode)
+		}
+		if bytes.Compare(word, last) < 0 {
+			return nil, dictError(off, string(word), ErrUnsorted)
+		}
+		add(word, int(i))
+		word, last = last, word
+	}
+	return encodes, nil
+}
+
+// A countReader counts the bytes read through it
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
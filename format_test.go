@@ -0,0 +1,205 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func formatTestWords(t *testing.T) ([]dict, []bits) {
+	words, encodes, err := readWordEncodings(nil, nil, bufio.NewScanner(strings.NewReader(
+		"cat\tn\ndog\tn,v\nrun\tv,er\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return words, encodes
+}
+
+func TestReadDict(t *testing.T) {
+	words, encodes := formatTestWords(t)
+	in := Metadata{
+		Language: "en",
+		Variant:  "british",
+		Sources:  []string{"list", "british"},
+		Built:    time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	n, err := writeDictFile(in, words, encodes, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != buf.Len() {
+		t.Errorf("writeDictFile returned %d, wrote %d bytes", n, buf.Len())
+	}
+	md, gotWords, gotEncodes, err := readDict(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := in
+	want.Version, want.Words, want.Codes = dictVersion, len(words), len(encodes)
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("metadata = %+v, want %+v", md, want)
+	}
+	if !reflect.DeepEqual(gotWords, words) || !reflect.DeepEqual(gotEncodes, encodes) {
+		t.Errorf("words = %v %v, want %v %v", gotWords, gotEncodes, words, encodes)
+	}
+}
+
+func TestReadDictLegacy(t *testing.T) {
+	words, encodes := formatTestWords(t)
+	var buf bytes.Buffer
+	if _, err := writeDict(words, encodes, &buf); err != nil {
+		t.Fatal(err)
+	}
+	md, gotWords, _, err := readDict(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Version != 0 || md.Words != len(words) || md.Codes != len(encodes) {
+		t.Errorf("metadata = %+v", md)
+	}
+	if !reflect.DeepEqual(gotWords, words) {
+		t.Errorf("words = %v, want %v", gotWords, words)
+	}
+}
+
+func TestReadDictErrors(t *testing.T) {
+	words, encodes := formatTestWords(t)
+	var buf bytes.Buffer
+	if _, err := writeDictFile(Metadata{Language: "en"}, words, encodes, &buf); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	corrupt := func(i int, b byte) []byte {
+		data := append([]byte(nil), good...)
+		data[i] = b
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"version", corrupt(len(dictMagic)+1, 9), ErrVersion},
+		{"checksum", corrupt(len(good)-6, good[len(good)-6]^1), ErrChecksum},
+		{"truncated", good[:len(dictMagic)+4], ErrTruncated},
+		{"short", good[:len(good)-1], ErrChecksum},
+	}
+	for _, test := range tests {
+		_, _, _, err := readDict(bytes.NewReader(test.data))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+// Words sharing long prefixes, with more affix codes than the legacy
+// layout can index
+func manyCodeWords() ([]dict, []bits) {
+	var words []dict
+	var encodes []bits
+	for i := 0; i < 3000; i++ {
+		encodes = append(encodes, bits(i+1))
+		words = append(words, dict{i: i, word: fmt.Sprintf("antidisestablishment%04d", i)})
+	}
+	words = append(words, dict{i: 0, word: "antidisestablishmentarianism"}, dict{i: 1, word: "supercalifragilisticexpialidocious"})
+	return words, encodes
+}
+
+func TestReadDictManyCodes(t *testing.T) {
+	words, encodes := manyCodeWords()
+	var buf bytes.Buffer
+	if _, err := writeDictFile(Metadata{}, words, encodes, &buf); err != nil {
+		t.Fatal(err)
+	}
+	_, gotWords, gotEncodes, err := readDict(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotWords, words) || !reflect.DeepEqual(gotEncodes, encodes) {
+		t.Error("words and codes do not round-trip")
+	}
+	if _, err := writeDict(words, encodes, &buf); !errors.Is(err, ErrLegacy) {
+		t.Errorf("writeDict err = %v, want %v", err, ErrLegacy)
+	}
+}
+
+func TestReadDictVersion1(t *testing.T) {
+	words, encodes := formatTestWords(t)
+	var body bytes.Buffer
+	if _, err := writeDict(words, encodes, &body); err != nil {
+		t.Fatal(err)
+	}
+	meta := (&Metadata{Words: len(words), Codes: len(encodes)}).marshal()
+	var buf bytes.Buffer
+	f := bufio.NewWriter(&buf)
+	f.WriteString(dictMagic)
+	sput(f, 1)
+	lput(f, uint32(len(meta)))
+	f.Write(meta)
+	f.Write(body.Bytes())
+	f.Flush()
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	md, gotWords, _, err := readDict(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Version != 1 || !reflect.DeepEqual(gotWords, words) {
+		t.Errorf("version %d words = %v, want %v", md.Version, gotWords, words)
+	}
+}
+
+func TestReadDictIndexed(t *testing.T) {
+	words, encodes := formatTestWords(t)
+	var buf bytes.Buffer
+	if _, err := writeDictFile(Metadata{Version: indexVersion, Language: "en"}, words, encodes, &buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	md, gotWords, gotEncodes, err := readDict(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Version != indexVersion || md.Words != len(words) || md.Codes != len(encodes) {
+		t.Errorf("metadata = %+v", md)
+	}
+	if !reflect.DeepEqual(gotWords, words) || !reflect.DeepEqual(gotEncodes, encodes) {
+		t.Errorf("words = %v %v, want %v %v", gotWords, gotEncodes, words, encodes)
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-1] ^= 1
+	if _, err := NewChecker(bytes.NewReader(bad)); err != nil {
+		t.Errorf("NewChecker checked the checksum of an indexed list: %v", err)
+	}
+	if _, _, _, err := readDict(bytes.NewReader(bad)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("readDict err = %v, want %v", err, ErrChecksum)
+	}
+
+	_, body, base, err := parseDict(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		body []byte
+		err  error
+	}{
+		{"truncated", body[:len(body)-1], ErrTruncated},
+		{"header", body[:8], ErrTruncated},
+		{"long", append(append([]byte(nil), body...), 0), ErrBadEntry},
+	}
+	for _, test := range tests {
+		if _, _, err := openIndex(test.body, base); !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
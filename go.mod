@@ -1,3 +1,5 @@
 module github.com/ughe/spell
 
-go 1.16
+go 1.17
+
+require golang.org/x/text v0.13.0
@@ -0,0 +1,291 @@
+package spell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+)
+
+// A hashSet holds a spelling list as McIlroy's "Development of a
+// Spelling List" describes: not the words, but hashes of them in the
+// range [0, modulus), sorted, their differences Golomb (Rice) coded.
+// With n words a word not in the list is accepted with probability
+// n/modulus, the false acceptance rate, at each lookup. Since a stop
+// list entry found for a stem rejects the word, a false match on one
+// can also reject a word. Each hash is followed by the index of the
+// affix code of its word. The hashes are coded in blocks of hashBlock,
+// whose first hashes and offsets are kept apart, so a lookup decodes
+// one block.
+type hashSet struct {
+	modulus  uint64
+	n        int    // number of hashes
+	rice     int    // low bits of each difference coded in binary
+	codeBits int    // bits of each code index
+	blocks   []byte // nblocks * {first uint64, offset uint32 of its bits}
+	stream   []byte // the coded hashes and code indexes
+}
+
+const hashBlock = 64
+
+// Returns the hash of w in [0, modulus)
+func hashWord(w []byte, modulus uint64) uint64 {
+	h := fnv.New64a()
+	h.Write(w)
+	return h.Sum64() % modulus
+}
+
+// Returns the range of hashes of n words for a false acceptance rate
+func hashRange(n int, rate float64) uint64 {
+	m := math.Ceil(float64(n) / rate)
+	if m >= 1<<63 {
+		return 1 << 63
+	}
+	if m < 1 {
+		return 1
+	}
+	return uint64(m)
+}
+
+// A hashEntry is a hash of a word and the index of its affix code
+type hashEntry struct {
+	hash uint64
+	i    int
+}
+
+// Returns the hashes of words in [0, modulus), sorted, with the
+// encodings they index. Words whose hashes collide are entered once,
+// with the union of their codes, which is added to encodes if new
+func hashWords(words []dict, encodes []bits, modulus uint64) ([]hashEntry, []bits) {
+	entries := make([]hashEntry, 0, len(words))
+	for _, word := range words {
+		entries = append(entries, hashEntry{hashWord([]byte(word.word), modulus), word.i})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].hash < entries[j].hash
+	})
+	encodes = append([]bits(nil), encodes...)
+	l := wordList{encodes: encodes}
+	n := 0
+	for _, e := range entries {
+		if n > 0 && entries[n-1].hash == e.hash {
+			entries[n-1].i = l.index(l.encodes[entries[n-1].i] | l.encodes[e.i])
+			continue
+		}
+		entries[n] = e
+		n++
+	}
+	return entries[:n], l.encodes
+}
+
+// Writes the hashes of words in [0, modulus), as hashWords returns
+// them, to w. All fixed-size numbers are big-endian.
+//
+//	struct {
+//	  modulus  uint64
+//	  ncodes   uint32
+//	  nhashes  uint32
+//	  nblocks  uint32
+//	  rice     uint8
+//	  codeBits uint8
+//	  encodes  [ncodes]uint32
+//	  blocks   [nblocks]struct{ first uint64; offset uint32 }
+//	  stream   []byte
+//	}
+//
+// Each hash is coded in stream as its difference from the one before
+// it, or from the first of its block: the difference shifted right by
+// rice in unary (ones ended by a zero), then its low rice bits. The
+// code index follows in codeBits bits. Bits are taken from the most
+// significant end of each byte. Returns the number of bytes written
+func writeHashed(entries []hashEntry, encodes []bits, modulus uint64, w io.Writer) (int, error) {
+	codeBits := 0
+	for 1<<codeBits < len(encodes) {
+		codeBits++
+	}
+	rice := bestRice(entries)
+
+	var blocks []byte
+	var s bitWriter
+	var last uint64
+	for k, e := range entries {
+		if k%hashBlock == 0 {
+			var b [12]byte
+			binary.BigEndian.PutUint64(b[:], e.hash)
+			binary.BigEndian.PutUint32(b[8:], uint32(s.n))
+			blocks = append(blocks, b[:]...)
+			last = e.hash
+		}
+		d := e.hash - last
+		s.unary(d >> uint(rice))
+		s.write(d, rice)
+		s.write(uint64(e.i), codeBits)
+		last = e.hash
+	}
+
+	var head bytes.Buffer
+	binary.Write(&head, binary.BigEndian, modulus)
+	for _, n := range []int{len(encodes), len(entries), len(blocks) / 12} {
+		head.Write(appendUint32(nil, n))
+	}
+	head.Write([]byte{byte(rice), byte(codeBits)})
+	for _, c := range encodes {
+		head.Write(appendUint32(nil, int(c)))
+	}
+	nBytes := 0
+	for _, b := range [][]byte{head.Bytes(), blocks, s.b} {
+		n, err := w.Write(b)
+		nBytes += n
+		if err != nil {
+			return nBytes, err
+		}
+	}
+	return nBytes, nil
+}
+
+// Returns the Rice parameter coding the differences of entries in the
+// fewest bits
+func bestRice(entries []hashEntry) int {
+	best, bestBits := 0, uint64(math.MaxUint64)
+	for rice := 0; rice < 64; rice++ {
+		total := uint64(0)
+		var last uint64
+		for k, e := range entries {
+			if k%hashBlock == 0 {
+				last = e.hash
+			}
+			total += (e.hash-last)>>uint(rice) + 1 + uint64(rice)
+			last = e.hash
+		}
+		if total < bestBits {
+			best, bestBits = rice, total
+		}
+	}
+	return best
+}
+
+// Returns the hash set, and the encodings, written by writeHashed as
+// body, which is used in place. Errors are DictErrors, at offsets from
+// base
+func openHashed(body []byte, base int64) (*hashSet, []bits, error) {
+	const head = 8 + 3*4 + 2
+	if len(body) < head {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	h := &hashSet{modulus: binary.BigEndian.Uint64(body)}
+	ncodes, n, nblocks := int64(u32(body[8:], 0)), int64(u32(body[8:], 1)), int64(u32(body[8:], 2))
+	h.n, h.rice, h.codeBits = int(n), int(body[head-2]), int(body[head-1])
+	size := head + 4*ncodes + 12*nblocks
+	if int64(len(body)) < size {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	if h.modulus == 0 || h.rice > 63 || h.codeBits > 32 || nblocks != (n+hashBlock-1)/hashBlock {
+		return nil, nil, dictError(base, "", ErrBadEntry)
+	}
+	encodes := make([]bits, ncodes)
+	for i := range encodes {
+		encodes[i] = bits(u32(body[head:], i))
+	}
+	h.blocks = body[head+4*ncodes : size : size]
+	h.stream = body[size:]
+	return h, encodes, nil
+}
+
+// Returns the index in encodes of the affix code of w, -1 if the hash
+// of w is not in h
+func (h *hashSet) lookup(w []byte) int {
+	nblocks := len(h.blocks) / 12
+	if nblocks == 0 {
+		return -1
+	}
+	x := hashWord(w, h.modulus)
+	b := sort.Search(nblocks, func(b int) bool {
+		return binary.BigEndian.Uint64(h.blocks[12*b:]) > x
+	}) - 1
+	if b < 0 {
+		return -1
+	}
+	v := binary.BigEndian.Uint64(h.blocks[12*b:])
+	r := bitReader{b: h.stream, n: u32(h.blocks[12*b+8:], 0)}
+	for k := b * hashBlock; k < h.n && k < (b+1)*hashBlock; k++ {
+		q, ok := r.unary()
+		hi, ok1 := r.read(h.rice)
+		i, ok2 := r.read(h.codeBits)
+		if !ok || !ok1 || !ok2 {
+			return -1
+		}
+		v += q<<uint(h.rice) | hi
+		if v == x {
+			return int(i)
+		}
+		if v > x {
+			break
+		}
+	}
+	return -1
+}
+
+// A bitWriter appends bits to b, most significant first
+type bitWriter struct {
+	b []byte
+	n int // bits written
+}
+
+// Writes the low nbits of v
+func (s *bitWriter) write(v uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		s.bit(v >> uint(i) & 1)
+	}
+}
+
+// Writes q in unary: q ones and a zero
+func (s *bitWriter) unary(q uint64) {
+	for ; q > 0; q-- {
+		s.bit(1)
+	}
+	s.bit(0)
+}
+
+func (s *bitWriter) bit(v uint64) {
+	if s.n%8 == 0 {
+		s.b = append(s.b, 0)
+	}
+	s.b[s.n/8] |= byte(v << uint(7-s.n%8))
+	s.n++
+}
+
+// A bitReader reads the bits of b from the nth, as bitWriter wrote them
+type bitReader struct {
+	b []byte
+	n int
+}
+
+// Returns the next nbits as a number, false if b ends first
+func (r *bitReader) read(nbits int) (uint64, bool) {
+	var v uint64
+	for ; nbits > 0; nbits-- {
+		if r.n >= 8*len(r.b) {
+			return 0, false
+		}
+		v = v<<1 | uint64(r.b[r.n/8]>>uint(7-r.n%8)&1)
+		r.n++
+	}
+	return v, true
+}
+
+// Returns the next number coded in unary, false if b ends first
+func (r *bitReader) unary() (uint64, bool) {
+	var q uint64
+	for {
+		v, ok := r.read(1)
+		if !ok {
+			return 0, false
+		}
+		if v == 0 {
+			return q, true
+		}
+		q++
+	}
+}
@@ -0,0 +1,81 @@
+package spell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Returns a Checker for the amspell lists hashed with rate, and the words
+// and codes of the lists
+func hashedChecker(t *testing.T, rate float64) (*Checker, []dict, []bits) {
+	data, words, encodes := testDictFile(t, Metadata{Version: hashVersion, FalseRate: rate}, testList(t, amspellPaths...))
+	if _, _, _, err := readDict(bytes.NewReader(data)); !errors.Is(err, ErrHashed) {
+		t.Errorf("readDict err = %v, want %v", err, ErrHashed)
+	}
+	c, err := NewChecker(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, words, encodes
+}
+
+func TestHashed(t *testing.T) {
+	c, words, encodes := hashedChecker(t, 1e-6)
+	if md := c.Metadata(); md.Version != hashVersion || md.FalseRate != 1e-6 {
+		t.Errorf("metadata = %+v", md)
+	}
+	for _, word := range words {
+		want := encodes[word.i]
+		if h := c.lookup([]byte(word.word)); h&want != want {
+			t.Fatalf("lookup(%q) = %s, want %s", word.word, codeToStr(h), codeToStr(want))
+		}
+	}
+	for word, want := range map[string]bool{"unreadable": true, "fibbing": true, "teh": false, "accidently": false} {
+		if got := c.Check(word); got != want {
+			t.Errorf("Check(%q) = %v, want %v", word, got, want)
+		}
+	}
+}
+
+func TestHashedFalseRate(t *testing.T) {
+	const rate, tries = 0.01, 50000
+	c, _, _ := hashedChecker(t, rate)
+	n := 0
+	for i := 0; i < tries; i++ {
+		if c.lookup([]byte(fmt.Sprintf("zq%dx", i))) != 0 {
+			n++
+		}
+	}
+	if got := float64(n) / tries; got < rate/2 || got > 2*rate {
+		t.Errorf("false acceptance rate %g, want about %g", got, rate)
+	}
+}
+
+func TestHashWordsCollisions(t *testing.T) {
+	words := []dict{{0, "cat"}, {1, "dog"}, {0, "cow"}}
+	entries, encodes := hashWords(words, []bits{NOUN, VERB}, 1) // all hash to 0
+	if len(entries) != 1 || encodes[entries[0].i] != NOUN|VERB {
+		t.Errorf("entries = %v, encodes = %v", entries, encodes)
+	}
+}
+
+func TestBits(t *testing.T) {
+	var w bitWriter
+	w.unary(3)
+	w.write(5, 3)
+	w.unary(0)
+	w.write(0x1ff, 9)
+	r := bitReader{b: w.b}
+	q, _ := r.unary()
+	v, _ := r.read(3)
+	q0, _ := r.unary()
+	v9, ok := r.read(9)
+	if q != 3 || v != 5 || q0 != 0 || v9 != 0x1ff || !ok || r.n != w.n {
+		t.Errorf("read %d %d %d %#x %v at bit %d of %d", q, v, q0, v9, ok, r.n, w.n)
+	}
+	if _, ok := r.read(8); ok {
+		t.Errorf("read past the end")
+	}
+}
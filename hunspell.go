@@ -0,0 +1,537 @@
+package spell
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/unicode/norm"
+)
+
+// An affixFile holds what the importer uses of a Hunspell .aff file
+type affixFile struct {
+	enc      encoding.Encoding // of the .aff and .dic files, nil for UTF-8
+	flagType string            // FLAG: "" (one character), long, num or UTF-8
+	aliases  [][]string        // AF flag vectors, numbered from 1
+	afCount  bool              // the first AF line, the count, was read
+	classes  map[string]*affixClass
+
+	forbidden, needAffix, onlyInCompound string // flags of those kinds
+	compound                             map[string]bool
+}
+
+// An affixClass is the PFX or SFX rules of a flag
+type affixClass struct {
+	prefix bool
+	cross  bool // may combine with affixes of the other kind
+	rules  []affixRule
+}
+
+// An affixRule replaces strip by add, at the start or end of a word
+// matching cond, and allows the affixes of the flags cont on the result
+type affixRule struct {
+	strip, add string
+	cont       []string
+	cond       []condChar
+}
+
+// A condChar matches a character of an affix condition: any one if any
+// is set, else one of set, or one not in set if neg is set
+type condChar struct {
+	set      string
+	neg, any bool
+}
+
+// Reads the affix file name from r. Errors are ListErrors
+func readAffixFile(name string, r io.Reader) (*affixFile, error) {
+	a := &affixFile{classes: make(map[string]*affixClass), compound: make(map[string]bool)}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line, err := a.decode(s.Text())
+		if err == nil {
+			err = a.parse(strings.Fields(line))
+		}
+		if err != nil {
+			return nil, &ListError{File: name, Line: n, Err: err}
+		}
+	}
+	return a, s.Err()
+}
+
+// Returns line decoded from the encoding of a, as NFC
+func (a *affixFile) decode(line string) (string, error) {
+	if a.enc != nil {
+		var err error
+		if line, err = a.enc.NewDecoder().String(line); err != nil {
+			return "", err
+		}
+	}
+	return norm.NFC.String(line), nil
+}
+
+// Takes in the directive of the fields of a line of an affix file
+func (a *affixFile) parse(f []string) error {
+	if len(f) < 2 || strings.HasPrefix(f[0], "#") {
+		return nil
+	}
+	switch f[0] {
+	case "SET":
+		name := strings.ToUpper(f[1])
+		if name == "UTF-8" {
+			return nil
+		}
+		if strings.HasPrefix(name, "ISO8859-") {
+			name = "ISO-8859-" + name[len("ISO8859-"):]
+		}
+		enc, err := ianaindex.IANA.Encoding(name)
+		if err != nil || enc == nil {
+			return fmt.Errorf("%w %q", ErrAffixEncoding, f[1])
+		}
+		a.enc = enc
+	case "FLAG":
+		a.flagType = f[1]
+	case "AF":
+		if !a.afCount {
+			a.afCount = true
+			return nil
+		}
+		a.aliases = append(a.aliases, a.splitFlags(f[1], false))
+	case "FORBIDDENWORD":
+		a.forbidden = f[1]
+	case "NEEDAFFIX", "PSEUDOROOT":
+		a.needAffix = f[1]
+	case "ONLYINCOMPOUND":
+		a.onlyInCompound = f[1]
+	case "COMPOUNDFLAG", "COMPOUNDBEGIN", "COMPOUNDMIDDLE", "COMPOUNDLAST", "COMPOUNDEND":
+		a.compound[f[1]] = true
+	case "PFX", "SFX":
+		return a.parseAffix(f)
+	}
+	return nil
+}
+
+// Takes in a PFX or SFX header (PFX flag cross count) or rule (PFX flag
+// strip add[/flags] condition)
+func (a *affixFile) parseAffix(f []string) error {
+	c := a.classes[f[1]]
+	if c == nil {
+		if len(f) < 4 {
+			return fmt.Errorf("%w: %q", ErrAffixLine, strings.Join(f, " "))
+		}
+		a.classes[f[1]] = &affixClass{prefix: f[0] == "PFX", cross: f[2] == "Y"}
+		return nil
+	}
+	if len(f) < 4 {
+		return fmt.Errorf("%w: %q", ErrAffixLine, strings.Join(f, " "))
+	}
+	rule := affixRule{strip: f[2], add: f[3]}
+	if rule.strip == "0" {
+		rule.strip = ""
+	}
+	if k := strings.IndexByte(rule.add, '/'); k >= 0 {
+		rule.add, rule.cont = rule.add[:k], a.splitFlags(rule.add[k+1:], true)
+	}
+	if rule.add == "0" {
+		rule.add = ""
+	}
+	cond := "."
+	if len(f) > 4 {
+		cond = f[4]
+	}
+	var err error
+	if rule.cond, err = parseCondition(cond); err != nil {
+		return fmt.Errorf("%w: condition %q: %v", ErrAffixLine, cond, err)
+	}
+	c.rules = append(c.rules, rule)
+	return nil
+}
+
+// Returns the flags of s as FLAG describes them, or the AF vector s
+// numbers if aliased is set and there are any
+func (a *affixFile) splitFlags(s string, aliased bool) []string {
+	if aliased && len(a.aliases) > 0 {
+		if k, err := strconv.Atoi(s); err == nil && k >= 1 && k <= len(a.aliases) {
+			return a.aliases[k-1]
+		}
+	}
+	var flags []string
+	switch a.flagType {
+	case "long":
+		for len(s) >= 2 {
+			_, n1 := utf8.DecodeRuneInString(s)
+			_, n2 := utf8.DecodeRuneInString(s[n1:])
+			flags, s = append(flags, s[:n1+n2]), s[n1+n2:]
+		}
+	case "num":
+		flags = strings.Split(s, ",")
+	default: // one byte per flag, or one character with FLAG UTF-8
+		for _, r := range s {
+			flags = append(flags, string(r))
+		}
+	}
+	return flags
+}
+
+// Returns the characters of an affix condition: ".", "y", "[^aeiou]y"
+func parseCondition(s string) ([]condChar, error) {
+	var cond []condChar
+	if s == "." {
+		return nil, nil
+	}
+	for s != "" {
+		switch s[0] {
+		case '.':
+			cond, s = append(cond, condChar{any: true}), s[1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.New("unclosed [")
+			}
+			c := condChar{set: s[1:end]}
+			if strings.HasPrefix(c.set, "^") {
+				c.set, c.neg = c.set[1:], true
+			}
+			cond, s = append(cond, c), s[end+1:]
+		default:
+			_, n := utf8.DecodeRuneInString(s)
+			cond, s = append(cond, condChar{set: s[:n]}), s[n:]
+		}
+	}
+	return cond, nil
+}
+
+// Reports whether the runes w, starting at the start of the word for a
+// prefix and ending at its end for a suffix, satisfy cond
+func matchCondition(cond []condChar, w []rune, prefix bool) bool {
+	if len(w) < len(cond) {
+		return false
+	}
+	if !prefix {
+		w = w[len(w)-len(cond):]
+	}
+	for k, c := range cond {
+		if !c.any && strings.ContainsRune(c.set, w[k]) == c.neg {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns word with the affix of r applied, false if r does not apply
+func (r *affixRule) apply(word string, prefix bool) (string, bool) {
+	runes := []rune(word)
+	if !matchCondition(r.cond, runes, prefix) || len(r.strip) >= len(word) {
+		return "", false
+	}
+	if prefix {
+		if !strings.HasPrefix(word, r.strip) {
+			return "", false
+		}
+		return r.add + word[len(r.strip):], true
+	}
+	if !strings.HasSuffix(word, r.strip) {
+		return "", false
+	}
+	return word[:len(word)-len(r.strip)] + r.add, true
+}
+
+// Returns the forms of word that Hunspell derives by the affixes of
+// flags, besides word itself: each affix, the affixes its rule allows
+// after it, and prefixes combined with suffixes where both allow it
+func (a *affixFile) expand(word string, flags []string) []string {
+	var forms []string
+	seen := map[string]bool{word: true}
+	add := func(w string) {
+		if !seen[w] {
+			seen[w] = true
+			forms = append(forms, w)
+		}
+	}
+	var crossed []string // word and its suffixed forms that take prefixes
+	crossed = append(crossed, word)
+	for _, fl := range flags {
+		c := a.classes[fl]
+		if c == nil || c.prefix {
+			continue
+		}
+		for _, r := range c.rules {
+			w, ok := r.apply(word, false)
+			if !ok {
+				continue
+			}
+			add(w)
+			if c.cross {
+				crossed = append(crossed, w)
+			}
+			a.continuations(w, r.cont, add)
+		}
+	}
+	for _, fl := range flags {
+		c := a.classes[fl]
+		if c == nil || !c.prefix {
+			continue
+		}
+		for _, r := range c.rules {
+			for k, w := range crossed {
+				if k > 0 && !c.cross {
+					break
+				}
+				w2, ok := r.apply(w, true)
+				if !ok {
+					continue
+				}
+				add(w2)
+				a.continuations(w2, r.cont, add)
+			}
+		}
+	}
+	return forms
+}
+
+// Passes to add the forms of w, derived by an affix, that the affixes
+// of the flags cont allowed after it derive
+func (a *affixFile) continuations(w string, cont []string, add func(string)) {
+	for _, fl := range cont {
+		c := a.classes[fl]
+		if c == nil {
+			continue
+		}
+		for _, r := range c.rules {
+			if w2, ok := r.apply(w, c.prefix); ok {
+				add(w2)
+			}
+		}
+	}
+}
+
+// The affix classes tried, in order, to derive the forms of an imported
+// word: each alone, then with ms for a doubled final consonant
+var importClasses = []string{"n", "vi", "ed", "er", "comp", "a", "adv", "ion", "na", "va", "man", "y", "pc", "in"}
+
+// Returns the affix classes from which the checker derives as many of
+// the forms of word as it can, and the forms it cannot derive
+func importCode(word string, forms []string) (bits, []string) {
+	var code bits
+	var missing []string
+	for _, form := range forms {
+		if derives(word, code, form) {
+			continue
+		}
+		found := false
+		for _, mono := range []bits{0, MONO} {
+			for _, name := range importClasses {
+				if c := code | nameCodes[name] | mono; derives(word, c, form) {
+					code, found = c, true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, form)
+		}
+	}
+	return code, missing
+}
+
+// Reports whether the checker derives form from the stem word with the
+// affix classes code
+func derives(word string, code bits, form string) bool {
+	if code == 0 {
+		return false
+	}
+	q := newQuery(form, func(w []byte) bits {
+		if string(w) == word {
+			return code
+		}
+		return 0
+	})
+	h := q.check()
+	return h != 0 && !isSet(h, STOP)
+}
+
+// ImportHunspell reads a Hunspell dictionary, its affix file from aff
+// and its words from dic, and writes it to w as an annotated list for
+// pcode. The affixes of each word are mapped onto the affix classes
+// under which the checker accepts the forms they derive. Forms no class
+// derives, and words Hunspell needs affixed or compounded, are listed
+// as words of their own (d), and reported to report with the words that
+// cannot be listed. Forbidden words go on the stop list. Returns the
+// number of words reported
+func ImportHunspell(w io.Writer, aff, dic io.Reader, report io.Writer) (int, error) {
+	return importHunspell(w, "aff", aff, "dic", dic, report)
+}
+
+// ImportHunspell with the names of the files, for errors and reports
+func importHunspell(w io.Writer, affName string, aff io.Reader, dicName string, dic io.Reader, report io.Writer) (int, error) {
+	a, err := readAffixFile(affName, aff)
+	if err != nil {
+		return 0, err
+	}
+	codes := make(map[string]bits)
+	list := func(word string, code bits) {
+		old, ok := codes[word]
+		switch {
+		case !ok || isSet(code, STOP):
+			codes[word] = code
+		case isSet(old, STOP):
+		case code == DONT_TOUCH:
+		case old == DONT_TOUCH:
+			codes[word] = code
+		default:
+			codes[word] = old | code
+		}
+	}
+
+	nreported := 0
+	reportf := func(format string, a ...interface{}) {
+		fmt.Fprintf(report, format, a...)
+		nreported++
+	}
+	s := bufio.NewScanner(dic)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line, err := a.decode(s.Text())
+		if err != nil {
+			return nreported, &ListError{File: dicName, Line: n, Err: err}
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 || n == 1 && len(f) == 1 && isNumber(f[0]) {
+			continue // the word count
+		}
+		entry := strings.ReplaceAll(f[0], `\/`, "\x00")
+		word, flagText := entry, ""
+		if k := strings.IndexByte(entry, '/'); k >= 0 {
+			word, flagText = entry[:k], entry[k+1:]
+		}
+		word = strings.ReplaceAll(word, "\x00", "/")
+		if _, _, err := parseEntry(word + "\tn"); err != nil {
+			reportf("%s:%d: %s: cannot be listed: %v\n", dicName, n, word, errors.Unwrap(err))
+			continue
+		}
+		var flags []string
+		if flagText != "" {
+			flags = a.splitFlags(flagText, true)
+		}
+		has := func(fl string) bool {
+			for _, f := range flags {
+				if f == fl && fl != "" {
+					return true
+				}
+			}
+			return false
+		}
+		if has(a.forbidden) {
+			list(word, STOP)
+			continue
+		}
+		if has(a.onlyInCompound) {
+			reportf("%s:%d: %s: only in compounds, which are not supported; left out\n", dicName, n, word)
+			continue
+		}
+		for _, fl := range flags {
+			if a.compound[fl] {
+				reportf("%s:%d: %s: compounds are not supported; listed alone\n", dicName, n, word)
+				break
+			}
+		}
+		forms := a.expand(word, flags)
+		var valid []string
+		for _, form := range forms {
+			if _, _, err := parseEntry(form + "\tn"); err == nil {
+				valid = append(valid, form)
+			} else {
+				reportf("%s:%d: %s: form %s cannot be listed\n", dicName, n, word, form)
+			}
+		}
+		if has(a.needAffix) {
+			reportf("%s:%d: %s: not a word without affixes; its forms are listed instead\n", dicName, n, word)
+			for _, form := range valid {
+				list(form, DONT_TOUCH)
+			}
+			continue
+		}
+		code, missing := importCode(word, valid)
+		if len(missing) > 0 {
+			reportf("%s:%d: %s/%s: %s not derived; listed as words\n", dicName, n, word, flagText, strings.Join(missing, " "))
+		}
+		if code == 0 {
+			code = DONT_TOUCH
+		}
+		list(word, code)
+		for _, form := range missing {
+			list(form, DONT_TOUCH)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nreported, err
+	}
+
+	words := make([]string, 0, len(codes))
+	for word := range codes {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	out := bufio.NewWriter(w)
+	for _, word := range words {
+		fmt.Fprintf(out, "%s\t%s\n", word, codeToNames(codes[word]))
+	}
+	return nreported, out.Flush()
+}
+
+// Returns true if s is a decimal number
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// main function for hunimport. Converts the Hunspell dictionary named
+// by its .aff and .dic files, or by their common base name, to an
+// annotated list on standard output, reporting on standard error what
+// it cannot represent
+func Hunimport() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: hunimport en_US | en_US.aff en_US.dic\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var affPath, dicPath string
+	switch flag.NArg() {
+	case 1:
+		affPath, dicPath = flag.Arg(0)+".aff", flag.Arg(0)+".dic"
+	case 2:
+		affPath, dicPath = flag.Arg(0), flag.Arg(1)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	aff, err := os.Open(affPath)
+	if err != nil {
+		fatalf("cannot open %s\n", affPath)
+	}
+	defer aff.Close()
+	dic, err := os.Open(dicPath)
+	if err != nil {
+		fatalf("cannot open %s\n", dicPath)
+	}
+	defer dic.Close()
+	n, err := importHunspell(os.Stdout, affPath, aff, dicPath, dic, os.Stderr)
+	if err != nil {
+		fatalf("hunimport: %v\n", err)
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "%d words reported\n", n)
+	}
+}
@@ -0,0 +1,110 @@
+package spell
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testAff = `SET UTF-8
+TRY esianrtolcdugmphbyfvkwz
+FORBIDDENWORD !
+NEEDAFFIX %
+ONLYINCOMPOUND c
+COMPOUNDFLAG Z
+
+SFX S Y 4
+SFX S   y     ies        [^aeiou]y
+SFX S   0     s          [aeiou]y
+SFX S   0     es         [sxzh]
+SFX S   0     s          [^sxzhy]
+
+SFX D Y 4
+SFX D   0     d          e
+SFX D   y     ied        [^aeiou]y
+SFX D   0     ed         [^ey]
+SFX D   0     ed         [aeiou]y
+
+SFX G Y 2
+SFX G   e     ing        e
+SFX G   0     ing        [^e]
+
+PFX U Y 1
+PFX U   0     un         .
+
+SFX N Y 1
+SFX N   0     ness/S     .
+
+SFX X N 1
+SFX X   0     xyzzy      .
+`
+
+func TestImportHunspell(t *testing.T) {
+	dic := "11\nwalk/DGS\ntry/DS\nbox/S\nkind/UN\nbad/X\nnope/!\nment/%S\nfugen/c\nsun/Z\na-b\nwalk/S\n"
+	var out, report strings.Builder
+	n, err := ImportHunspell(&out, strings.NewReader(testAff), strings.NewReader(dic), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "bad\td\nbadxyzzy\td\nbox\tn\nkind\ta\nments\td\nnope\ts\nsun\td\ntry\tn,ed\nwalk\tn,v\n"
+	if out.String() != want {
+		t.Errorf("list =\n%s\nwant\n%s", out.String(), want)
+	}
+	for _, s := range []string{"dic:6: bad/X: badxyzzy not derived", "dic:8: ment: not a word", "dic:9: fugen: only in compounds",
+		"dic:10: sun: compounds", "dic:11: a-b: cannot be listed"} {
+		if !strings.Contains(report.String(), s) {
+			t.Errorf("report does not contain %q:\n%s", s, report.String())
+		}
+	}
+	if n != 5 {
+		t.Errorf("%d words reported, want 5", n)
+	}
+
+	// The list checks as the dictionary does
+	c := testChecker(t, Metadata{}, out.String())
+	for word, want := range map[string]bool{"walking": true, "walks": true, "tries": true, "boxes": true, "unkind": true,
+		"kindnesses": true, "badxyzzy": true, "nope": false, "ment": false, "ments": true} {
+		if got := c.Check(word); got != want {
+			t.Errorf("Check(%q) = %v, want %v", word, got, want)
+		}
+	}
+}
+
+func TestImportHunspellFlags(t *testing.T) {
+	tests := []struct{ aff, dic, want string }{
+		{"FLAG long\nSFX Sx Y 1\nSFX Sx 0 s .\nSFX Dx Y 1\nSFX Dx 0 ed .\n", "walk/SxDx\n", "walk\tn,ed\n"},
+		{"FLAG num\nSFX 1 Y 1\nSFX 1 0 s .\nSFX 2 Y 1\nSFX 2 0 ed .\n", "walk/1,2\n", "walk\tn,ed\n"},
+		{"AF 1\nAF SD\nSFX S Y 1\nSFX S 0 s .\nSFX D Y 1\nSFX D 0 ed .\n", "walk/1\n", "walk\tn,ed\n"},
+		{"SET ISO8859-1\nSFX S Y 1\nSFX S 0 s .\nSFX D Y 1\nSFX D 0 ed .\n", "walk/SD\ncaf\xe9/S\n", "café\tn\nwalk\tn,ed\n"},
+	}
+	for _, test := range tests {
+		var out, report strings.Builder
+		if _, err := ImportHunspell(&out, strings.NewReader(test.aff), strings.NewReader(test.dic), &report); err != nil {
+			t.Errorf("%q: %v", test.aff, err)
+			continue
+		}
+		if out.String() != test.want {
+			t.Errorf("%q: list =\n%s\nwant\n%s", test.aff, out.String(), test.want)
+		}
+	}
+}
+
+func TestImportHunspellErrors(t *testing.T) {
+	tests := []struct {
+		aff  string
+		line int
+		err  error
+	}{
+		{"SET KOI9-Z\n", 1, ErrAffixEncoding},
+		{"# x\nSFX S Y 1\nSFX S 0\n", 3, ErrAffixLine},
+		{"SFX S Y\n", 1, ErrAffixLine},
+		{"SFX S Y 1\nSFX S 0 s [aeiou\n", 2, ErrAffixLine},
+	}
+	for _, test := range tests {
+		_, err := ImportHunspell(&strings.Builder{}, strings.NewReader(test.aff), strings.NewReader("walk\n"), &strings.Builder{})
+		var le *ListError
+		if !errors.As(err, &le) || le.File != "aff" || le.Line != test.line || !errors.Is(err, test.err) {
+			t.Errorf("%q: err = %v, want line %d: %v", test.aff, err, test.line, test.err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// A wordSet finds the words of a spelling list
+type wordSet interface {
+	// Returns the index in encodes of the affix code of w, -1 if w
+	// is not in the list
+	lookup(w []byte) int
+}
+
+// An index finds the words of a spelling list. The words are packed
+// back to back in one array, in the order added, and found through an
+// open-addressed hash table, so a lookup costs one hash of the word and
+// usually one comparison. It replaces the space and spacep tables of
+// v10spell, which held a string per word and a 16K-entry bucket table.
+// The arrays are held as they are laid out in an indexed dictionary
+// file (see writeIndex), so that one can be used where it lies in
+// memory, mapped or not, without decoding.
+type index struct {
+	arena []byte // the words, back to back
+	off   []byte // word k is arena[off[k]:off[k+1]]
+	code  []byte // index in encodes of the affix code of word k
+	table []byte // k+1 for word k, 0 for an empty slot; the count is a power of 2
+}
+
+// off, code and table are arrays of big-endian uint32s. Returns
+// element k of b
+func u32(b []byte, k int) int {
+	return int(binary.BigEndian.Uint32(b[4*k:]))
+}
+
+func appendUint32(b []byte, v int) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Appends word, whose affix code is encodes[i], to x. Call build once
+// all words are added
+func (x *index) add(word []byte, i int) {
+	if len(x.off) == 0 {
+		x.off = appendUint32(x.off, 0)
+	}
+	x.arena = append(x.arena, word...)
+	x.off = appendUint32(x.off, len(x.arena))
+	x.code = appendUint32(x.code, i)
+}
+
+// Builds the hash table of x, at most half full
+func (x *index) build() {
+	x.arena = append([]byte(nil), x.arena...) // drop the spare capacity
+	if len(x.off) == 0 {
+		x.off = appendUint32(x.off, 0)
+	}
+	size := 1
+	for size < 2*x.len() {
+		size <<= 1
+	}
+	x.table = make([]byte, 4*size)
+	mask := size - 1
+	for k := 0; k < x.len(); k++ {
+		h := int(hash(x.word(k))) & mask
+		for u32(x.table, h) != 0 {
+			h = (h + 1) & mask
+		}
+		binary.BigEndian.PutUint32(x.table[4*h:], uint32(k+1))
+	}
+}
+
+// Returns the number of words in x
+func (x *index) len() int {
+	return len(x.code) / 4
+}
+
+// Returns word k of x, nil if its offsets are out of range
+func (x *index) word(k int) []byte {
+	lo, hi := u32(x.off, k), u32(x.off, k+1)
+	if lo < 0 || lo > hi || hi > len(x.arena) {
+		return nil
+	}
+	return x.arena[lo:hi]
+}
+
+// Returns the index in encodes of the affix code of w, -1 if w is not
+// in x. A word added twice is found as first added
+func (x *index) lookup(w []byte) int {
+	size := len(x.table) / 4
+	h := int(hash(w)) & (size - 1)
+	for n := 0; n < size; n++ {
+		k := u32(x.table, h) - 1
+		if k < 0 {
+			break
+		}
+		if k < x.len() && bytes.Equal(x.word(k), w) {
+			return u32(x.code, k)
+		}
+		h = (h + 1) & (size - 1)
+	}
+	return -1
+}
+
+// Returns the 32-bit FNV-1a hash of w
+func hash(w []byte) uint32 {
+	h := uint32(2166136261)
+	for _, c := range w {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return h
+}
+
+// Writes the sorted words and their codes to w as an index, which
+// openIndex uses in place. All numbers are big-endian.
+//
+//	struct {
+//	  ncodes  uint32
+//	  nwords  uint32
+//	  nslots  uint32 // a power of 2 greater than nwords
+//	  narena  uint32
+//	  encodes [ncodes]uint32
+//	  off     [nwords+1]uint32
+//	  code    [nwords]uint32
+//	  table   [nslots]uint32
+//	  arena   [narena]byte
+//	}
+//
+// Returns the number of bytes written
+func writeIndex(words []dict, encodes []bits, w io.Writer) (int, error) {
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].word < words[j].word
+	})
+	var x index
+	for _, word := range words {
+		x.add([]byte(word.word), word.i)
+	}
+	x.build()
+
+	head := make([]byte, 0, 16+4*len(encodes))
+	for _, n := range []int{len(encodes), x.len(), len(x.table) / 4, len(x.arena)} {
+		head = appendUint32(head, n)
+	}
+	for _, c := range encodes {
+		head = appendUint32(head, int(c))
+	}
+	f := bufio.NewWriter(w)
+	nBytes := 0
+	for _, b := range [][]byte{head, x.off, x.code, x.table, x.arena} {
+		n, _ := f.Write(b)
+		nBytes += n
+	}
+	return nBytes, f.Flush()
+}
+
+// Returns the index, and the encodings, written by writeIndex as body,
+// which is used in place. Only the layout is checked, so that opening
+// takes the same time whatever the size of the list. Errors are
+// DictErrors, at offsets from base
+func openIndex(body []byte, base int64) (*index, []bits, error) {
+	if len(body) < 16 {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	ncodes, nwords := int64(u32(body, 0)), int64(u32(body, 1))
+	nslots, narena := int64(u32(body, 2)), int64(u32(body, 3))
+	size := 16 + 4*ncodes + 4*(nwords+1) + 4*nwords + 4*nslots + narena
+	if int64(len(body)) < size {
+		return nil, nil, dictError(base, "", ErrTruncated)
+	}
+	if int64(len(body)) > size || nslots <= nwords || nslots&(nslots-1) != 0 {
+		return nil, nil, dictError(base, "", ErrBadEntry)
+	}
+
+	encodes := make([]bits, ncodes)
+	for i := range encodes {
+		encodes[i] = bits(u32(body, 4+i))
+	}
+	p := 16 + 4*ncodes // start of the next array
+	next := func(n int64) []byte {
+		b := body[p : p+n : p+n]
+		p += n
+		return b
+	}
+	x := &index{off: next(4 * (nwords + 1)), code: next(4 * nwords), table: next(4 * nslots), arena: next(narena)}
+	if u32(x.off, 0) != 0 || int64(u32(x.off, int(nwords))) != narena {
+		return nil, nil, dictError(base+16+4*ncodes, "", ErrBadEntry)
+	}
+	return x, encodes, nil
+}
+
+// Passes the words of x, and the indexes of their encodings, in order
+// to add, checking each as decodeDict does. Errors are DictErrors,
+// at offsets from base
+func scanIndex(x *index, ncodes int, base int64, add func(word []byte, i int)) error {
+	var last []byte
+	for k := 0; k < x.len(); k++ {
+		word, i := x.word(k), u32(x.code, k)
+		switch {
+		case word == nil:
+			return dictError(base, string(last), ErrBadEntry)
+		case i >= ncodes:
+			return dictError(base, string(word), ErrBadCode)
+		case bytes.Compare(word, last) < 0:
+			return dictError(base, string(word), ErrUnsorted)
+		}
+		add(word, i)
+		last = word
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package spell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The index of v10spell, which index replaces, kept to compare with it.
+//
+// layout in memory: common prefixes are expanded, and the
+// first two letters of each word are deleted and found
+// instead by lookup in table spacep, which holds the index
+// in space of the first word for each two-letter prefix
+// (words starting with "xx" are space[spacep[xx]:spacep[xx+1]]).
+// A one-letter word "x" is filed under "x\0", as no word holds a NUL.
+// Words not starting with ASCII bytes are kept whole in wide.
+func indexDict(words []dict) ([]dict, [128*128 + 1]int, []dict) {
+	var spacep [128*128 + 1]int
+	var wide []dict
+
+	space := make([]dict, 0, len(words)) // sorted words (first two letters deleted)
+	sp := 0                              // next index into spacep to fill
+	for _, word := range words {
+		i, n := spaceKey(word.word) // index in spacep, bytes of word it stands for
+		if n < 0 {
+			wide = append(wide, word)
+			continue
+		}
+		for sp <= i {
+			spacep[sp] = len(space)
+			sp++
+		}
+		space = append(space, dict{i: word.i, word: word.word[n:]})
+	}
+	for sp < len(spacep) {
+		spacep[sp] = len(space)
+		sp++
+	}
+
+	return space, spacep, wide
+}
+
+// Returns the index in spacep of the words starting as w does and the
+// number of bytes of w it stands for, -1 if w belongs in wide
+func spaceKey(w string) (int, int) {
+	switch {
+	case len(w) == 0 || w[0]&0x80 != 0:
+		return 0, -1
+	case len(w) == 1:
+		return int(w[0]) * 128, 1
+	case w[1]&0x80 != 0:
+		return 0, -1
+	}
+	return int(w[0])*128 + int(w[1]), 2
+}
+
+// Returns the affix classes of w in the spelling list indexed by indexDict,
+// 0 if w is not in it
+func lookup(encodes []bits, space []dict, spacep *[128*128 + 1]int, wide []dict, w []byte) bits {
+	words, rest := wide, string(w)
+	if i, n := spaceKey(rest); n >= 0 {
+		words, rest = space[spacep[i]:spacep[i+1]], rest[n:]
+	}
+	k := sort.Search(len(words), func(k int) bool {
+		return words[k].word >= rest
+	})
+	if k < len(words) && words[k].word == rest {
+		return encodes[words[k].i]
+	}
+	return 0
+}
+
+// Returns an index of the words and codes of list
+func testIndex(t testing.TB, list string) (*index, []dict, []bits) {
+	data, _, _ := testDictFile(t, Metadata{}, list)
+	var x index
+	if _, _, err := scanDict(bytes.NewReader(data), x.add); err != nil {
+		t.Fatal(err)
+	}
+	x.build()
+	_, words, encodes, err := readDict(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &x, words, encodes
+}
+
+func TestIndexShortWords(t *testing.T) {
+	x, words, encodes := testIndex(t, "a\tn\nI\tpc\n&\tn\nb\tn\nab\tn\na'\tn\naa\tn\né\tn\néa\tn\naé\tn\nzz\tn\n")
+	space, spacep, wide := indexDict(words)
+	for _, w := range strings.Fields("a I & b ab a' aa é éa aé zz") {
+		if x.lookup([]byte(w)) < 0 {
+			t.Errorf("lookup(%q) = -1", w)
+		}
+		if lookup(encodes, space, &spacep, wide, []byte(w)) == 0 {
+			t.Errorf("old lookup(%q) = 0", w)
+		}
+	}
+	for _, w := range []string{"", "i", "c", "aab", "z", "ü", "\x00"} {
+		if i := x.lookup([]byte(w)); i >= 0 {
+			t.Errorf("lookup(%q) = %d, want -1", w, i)
+		}
+		if h := lookup(encodes, space, &spacep, wide, []byte(w)); h != 0 {
+			t.Errorf("old lookup(%q) = %s, want 0", w, codeToStr(h))
+		}
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	var x index
+	x.build()
+	if i := x.lookup([]byte("a")); i >= 0 {
+		t.Errorf("lookup in empty index = %d", i)
+	}
+}
+
+func TestIndexMatchesSpacep(t *testing.T) {
+	x, words, encodes := testIndex(t, testList(t, amspellPaths...))
+	space, spacep, wide := indexDict(words)
+	for _, word := range words {
+		for _, w := range []string{word.word, word.word + "s", word.word[1:]} {
+			var got bits
+			if i := x.lookup([]byte(w)); i >= 0 {
+				got = encodes[i]
+			}
+			if want := lookup(encodes, space, &spacep, wide, []byte(w)); got != want {
+				t.Fatalf("lookup(%q) = %s, old lookup %s", w, codeToStr(got), codeToStr(want))
+			}
+		}
+	}
+}
+
+// Returns the words to look up in the benchmarks: those of the list
+// and as many that are not in it
+func benchWords(words []dict) [][]byte {
+	var ws [][]byte
+	for _, word := range words {
+		ws = append(ws, []byte(word.word), []byte(word.word+"x"))
+	}
+	sort.Slice(ws, func(i, j int) bool { return hash(ws[i])%7 < hash(ws[j])%7 }) // not in order
+	return ws
+}
+
+func BenchmarkLookupIndex(b *testing.B) {
+	x, words, _ := testIndex(b, testList(b, amspellPaths...))
+	ws := benchWords(words)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		x.lookup(ws[n%len(ws)])
+	}
+}
+
+func BenchmarkLookupSpacep(b *testing.B) {
+	_, words, encodes := testIndex(b, testList(b, amspellPaths...))
+	space, spacep, wide := indexDict(words)
+	ws := benchWords(words)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		lookup(encodes, space, &spacep, wide, ws[n%len(ws)])
+	}
+}
+
+// Returns the amspell dictionary file
+func amspellData(b *testing.B) []byte {
+	data, err := dictionaries.ReadFile("dictionaries/amspell")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// Reports the memory held by what load returns
+func reportHeap(b *testing.B, load func() interface{}) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	v := load()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(v)
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc), "heap-bytes")
+}
+
+func BenchmarkLoadIndex(b *testing.B) {
+	data := amspellData(b)
+	load := func() interface{} {
+		x := new(index)
+		if _, _, err := scanDict(bytes.NewReader(data), x.add); err != nil {
+			b.Fatal(err)
+		}
+		x.build()
+		return x
+	}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		load()
+	}
+	b.StopTimer()
+	reportHeap(b, load)
+}
+
+func BenchmarkLoadSpacep(b *testing.B) {
+	data := amspellData(b)
+	type spacepIndex struct {
+		space, wide []dict
+		spacep      [128*128 + 1]int
+	}
+	load := func() interface{} {
+		_, words, _, err := readDict(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		x := new(spacepIndex)
+		x.space, x.spacep, x.wide = indexDict(words)
+		return x
+	}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		load()
+	}
+	b.StopTimer()
+	reportHeap(b, load)
+}
+
+// Opens the amspell list written with md, as spell -f does
+func benchmarkOpen(b *testing.B, md Metadata) {
+	data, _, _ := testDictFile(b, md, testList(b, amspellPaths...))
+	path := filepath.Join(b.TempDir(), "amspell")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		c, err := Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.Close()
+	}
+}
+
+func BenchmarkOpenIndexed(b *testing.B) {
+	benchmarkOpen(b, Metadata{Version: indexVersion})
+}
+
+func BenchmarkOpenCompact(b *testing.B) {
+	benchmarkOpen(b, Metadata{})
+}
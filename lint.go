@@ -0,0 +1,221 @@
+package spell
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LintRules checks the rule file name, read from r, for rules that
+// cannot work as written: bad lines, suffixes never tried because an
+// earlier one matches first, suffixes out of order, blockers that block
+// nothing and affix classes that can never match. Classes are checked
+// against the codes of dicts, or of any annotated list if there are
+// none. The problems are returned as RuleErrors, with notes describing
+// what each blocker blocks and which prefixes are tried after shorter
+// ones they begin with
+func LintRules(name string, r io.Reader, dicts ...*Checker) ([]error, []string, error) {
+	rules := Rules{keepGoing: true}
+	if err := rules.read(name, bufio.NewScanner(r)); err != nil {
+		return nil, nil, err
+	}
+	l := linter{Rules: &rules, name: name, problems: rules.errs}
+	for _, b := range nameCodes {
+		l.have |= b
+	}
+	if len(dicts) > 0 {
+		l.have = 0
+		for _, c := range dicts {
+			for _, code := range c.encodes {
+				l.have |= code
+			}
+		}
+	}
+	l.suffixes()
+	l.prefixes()
+	return l.problems, l.notes, nil
+}
+
+// A linter collects the problems of a rule file
+type linter struct {
+	*Rules
+	name     string
+	have     bits // affix classes of the dictionary codes
+	problems []error
+	notes    []string
+}
+
+func (l *linter) report(line int, err error, format string, a ...interface{}) {
+	l.problems = append(l.problems, &RuleError{File: l.name, Line: line,
+		Err: fmt.Errorf("%w: %s", err, fmt.Sprintf(format, a...))})
+}
+
+// Returns true if t strips nothing, so that it only stops the shorter
+// suffixes after it from being tried (graphyer, before er)
+func (t *suffix) blocker() bool {
+	return opName(t.p1) == "nop" && opName(t.p2) == "nop"
+}
+
+// Checks the order and classes of the suffix rules. Only the first
+// suffix matching the end of a word, and leaving a vowel before the n
+// bytes its op removes, is tried
+func (l *linter) suffixes() {
+	less := orderSuffix(l.suf)
+	for j := range l.suf {
+		b, line := &l.suf[j], l.sufLine[j]
+		if j > 0 {
+			if a := &l.suf[j-1]; b.s[len(b.s)-1] < a.s[len(a.s)-1] {
+				l.report(line, ErrRuleOrder, "-%s is not grouped with the suffixes ending in %q", b.s, b.s[len(b.s)-1])
+			}
+		}
+		for i := 0; i < j; i++ {
+			a := &l.suf[i]
+			if !strings.HasSuffix(b.s, a.s) || !(less(j, i) || a.s == b.s) {
+				continue // orderSuffix puts b.s first if it ends in a.s
+			}
+			// A word ending in b.s ends in a.s, which is tried unless
+			// it leaves no vowel, in which case b.s must leave one
+			if hasVowel([]byte(stemOf(b.s, a.n1))) || !hasVowel([]byte(stemOf(b.s, b.n1))) {
+				l.report(line, ErrRuleShadowed, "-%s is never tried, since -%s (line %d) matches first", b.s, a.s, l.sufLine[i])
+			} else {
+				l.report(line, ErrRuleOrder, "-%s is tried only when -%s (line %d) leaves no vowel; put it first", b.s, a.s, l.sufLine[i])
+			}
+			break
+		}
+
+		if b.blocker() {
+			var blocked []string
+			for k := j + 1; k < len(l.suf); k++ {
+				if c := l.suf[k].s; strings.HasSuffix(b.s, c) && c != b.s {
+					blocked = append(blocked, "-"+c)
+				}
+			}
+			if len(blocked) == 0 {
+				l.report(line, ErrRuleBlocker, "-%s blocks no later suffix", b.s)
+			} else {
+				l.notes = append(l.notes, fmt.Sprintf("%s:%d: -%s stops %s from being stripped from words ending in -%s",
+					l.name, line, b.s, strings.Join(blocked, ", "), b.s))
+			}
+			continue
+		}
+		if b.flag&^(STOP|MONO)&l.have == 0 {
+			l.report(line, ErrRuleMask, "-%s looks up stems of classes %s, which no affix code has", b.s, ruleNames(b.flag))
+		}
+		if b.affixable&^(NOPREF|MONO|IN) == 0 {
+			l.report(line, ErrRuleMask, "-%s applies to words looked up as %s, which none are", b.s, ruleNames(b.affixable))
+		}
+	}
+}
+
+// Returns the part of a word ending in s before which a vowel must be
+// left for a suffix removing n bytes of s: s less its last n bytes, as
+// far as it is known
+func stemOf(s string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	return s[:len(s)-n]
+}
+
+// Checks the classes of the prefix rules. Every prefix that matches is
+// tried, whatever an earlier one returns, so their order only decides
+// which derivation of a word is found first; a prefix tried after a
+// shorter one it begins with is noted
+func (l *linter) prefixes() {
+	for j, p := range l.pref {
+		line := l.prefLine[j]
+		for i, q := range l.pref[:j] {
+			if p.s == q.s {
+				l.report(line, ErrRuleShadowed, "%s- repeats line %d", p.s, l.prefLine[i])
+				break
+			}
+			if strings.HasPrefix(p.s, q.s) {
+				l.notes = append(l.notes, fmt.Sprintf("%s:%d: %s- is tried after %s- (line %d); a word both derive gets the derivation %s+",
+					l.name, line, p.s, q.s, l.prefLine[i], q.s))
+				break
+			}
+		}
+		if p.flag&^IN != 0 {
+			l.report(line, ErrRuleMask, "%s- has classes %s; only in applies to prefixes", p.s, ruleNames(p.flag))
+		}
+	}
+}
+
+// Returns the affix classes b as written in a rule file
+func ruleNames(b bits) string {
+	if b == 0 {
+		return "-"
+	}
+	return codeToNames(b)
+}
+
+// main function for rulelint. Checks the named rule files, or the
+// built-in rules, against the built-in lists or those given with -f
+func Rulelint() {
+	v := flag.Bool("v", false, "Also describe what each blocker (a suffix whose op is nop) blocks")
+	var paths []string
+	flag.Func("f", "Path to an encoded spell dictionary file whose affix codes the rules must match (may be repeated). Defaults to the built-in lists", func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	flag.Parse()
+
+	var dicts []*Checker
+	for _, path := range paths {
+		c, err := Open(path)
+		if err != nil {
+			fatalf("rulelint: %v\n", err)
+		}
+		dicts = append(dicts, c)
+	}
+	if len(paths) == 0 {
+		for _, open := range []func() (*Checker, error){American, British} {
+			c, err := open()
+			if err != nil {
+				fatalf("rulelint: %v\n", err)
+			}
+			dicts = append(dicts, c)
+		}
+	}
+
+	n := 0
+	lint := func(name string, r io.Reader) {
+		problems, notes, err := LintRules(name, r, dicts...)
+		if err != nil {
+			fatalf("rulelint: %s: %v\n", name, err)
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if *v {
+			for _, note := range notes {
+				fmt.Println(note)
+			}
+		}
+		n += len(problems)
+	}
+	if flag.NArg() == 0 {
+		data, err := dictionaries.ReadFile("dictionaries/rules")
+		if err != nil {
+			fatalf("rulelint: %v\n", err)
+		}
+		lint("dictionaries/rules", strings.NewReader(string(data)))
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fatalf("cannot open %s\n", path)
+		}
+		lint(path, f)
+		f.Close()
+	}
+	for _, c := range dicts {
+		c.Close()
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package spell
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLintDefaultRules(t *testing.T) {
+	data, err := dictionaries.ReadFile("dictionaries/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, err := American()
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, notes, err := LintRules("rules", bytes.NewReader(data), am)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+	// four blockers, and v10spell's order of immuno-, inter- and intra-
+	if len(notes) != 7 || !strings.Contains(notes[0], "-graphyer stops -er") ||
+		!strings.Contains(notes[4], "immuno- is tried after im-") {
+		t.Errorf("notes = %q", notes)
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	text := `suffix ed strip 1 - +d ed a,comp
+suffix eeing strip 3 - +ing vi n,a
+suffix ing CCe 3 -e+ing +ing vi n,ed,a
+suffix eing strip 3 - +ing vi n,a
+suffix ping strip 4 - +ping vi n,a
+suffix zzing nop 0 - - - n
+suffix ful ily 3 -y+iful +ful na bogus
+suffix ism CCe 3 -e+ism ism a,na n
+suffix ly ily 2 -y+ily +ly a adv,comp
+suffix ment strip 4 - +ment - n
+suffix ty strip 2 - +ty a in,ms
+prefix in in
+prefix inter -
+prefix un in,n
+prefix un in
+`
+	problems, notes, err := LintRules("test", strings.NewReader(text), american(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line int
+		err  error
+	}{
+		{7, ErrAffixCode},
+		{4, ErrRuleShadowed}, // -ing leaves a vowel (e)
+		{5, ErrRuleShadowed}, // -ping leaves none where -ing leaves none
+		{6, ErrRuleOrder},    // tried only for words like bzzing
+		{6, ErrRuleBlocker},
+		{10, ErrRuleOrder}, // t among the y suffixes
+		{10, ErrRuleMask},
+		{11, ErrRuleMask},
+		{14, ErrRuleMask},
+		{15, ErrRuleShadowed},
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.Error())
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("problems:\n%s", strings.Join(got, "\n"))
+	}
+	for k, w := range want {
+		var re *RuleError
+		if !errors.As(problems[k], &re) || re.File != "test" || re.Line != w.line || !errors.Is(re, w.err) {
+			t.Errorf("problem %d = %v, want line %d: %v", k, problems[k], w.line, w.err)
+		}
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "test:13: inter- is tried after in-") {
+		t.Errorf("notes = %q", notes)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package spell
+
+import "os"
+
+// Returns the contents of f, read into memory where they cannot be
+// mapped, and a function that releases them
+func mapFile(f *os.File) ([]byte, func() error, error) {
+	return readFile(f)
+}
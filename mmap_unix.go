@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package spell
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the contents of f, mapped read-only into memory, and a
+// function that unmaps them
+func mapFile(f *os.File) ([]byte, func() error, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size == 0 || !fi.Mode().IsRegular() || int64(int(size)) != size {
+		return readFile(f)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return readFile(f)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
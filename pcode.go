@@ -2,16 +2,24 @@ package spell
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 type dict struct {
-	i    uint16 // (i & 0x07FF) is index of encodes (type []bits)
+	i    int // index of encodes (type []bits)
 	word string
 }
 
@@ -21,73 +29,312 @@ func fatalf(format string, a ...interface{}) {
 }
 
 // read an annotated spelling list in form
+//
 //	word <tab> affixcode [ , affixcode ] ...
-// print a reencoded version
+//
+// print a reencoded version. With -d, read reencoded versions and
+// print the annotated list
 func Pcode() {
-	words := make([]dict, 0)
-	encodes := make([]bits, 0) // Max size 2^11 (index fits in 11 bits)
-	var err error
+	d := flag.Bool("d", false, "Decode: print the annotated list held in encoded spell dictionary files")
+	lang := flag.String("lang", "en", "Language of the words, recorded in the dictionary metadata")
+	variant := flag.String("variant", "", "Variant of the language (e.g. american), recorded in the dictionary metadata")
+	keepGoing := flag.Bool("k", false, "Keep going past bad lines in the lists, reporting all of them")
+	indexed := flag.Bool("index", false, "Write an indexed dictionary, which is larger but is looked up in place by spell -f")
+	hashRate := flag.Float64("hash", 0, "Write a hashed dictionary, holding no words, that accepts a word not in the list with this probability (e.g. 1e-5)")
+	automaton := flag.Bool("dawg", false, "Write the list as a minimized automaton, which is looked up in place and can list words by prefix or near a misspelling")
+	legacy := flag.Bool("legacy", false, "Write the legacy v10 layout, without metadata (at most 2048 codes, ASCII words)")
+	flag.Parse()
+
+	formats := 0
+	for _, set := range []bool{*indexed, *hashRate != 0, *automaton, *legacy} {
+		if set {
+			formats++
+		}
+	}
+	if formats > 1 {
+		fmt.Fprintf(os.Stderr, "pcode: only one of -index, -hash, -dawg and -legacy may be given\n")
+		flag.Usage()
+		os.Exit(2)
+	}
 
-	if len(os.Args) <= 1 {
-		s := bufio.NewScanner(os.Stdin)
-		words, encodes, err = readWordEncodings(words, encodes, s)
-		if err != nil {
+	if *d {
+		decode()
+		return
+	}
+
+	l := wordList{keepGoing: *keepGoing}
+	if flag.NArg() == 0 {
+		if err := l.read("<stdin>", bufio.NewScanner(os.Stdin)); err != nil {
 			fatalf("%v\n", err)
 		}
 	}
 
-	for _, path := range os.Args[1:] {
+	for _, path := range flag.Args() {
 		f, err := os.Open(path)
 		if err != nil {
 			fatalf("cannot open %s\n%v\n", path, err)
 		}
-		defer f.Close()
-		s := bufio.NewScanner(f)
-		words, encodes, err = readWordEncodings(words, encodes, s)
+		err = l.read(filepath.Base(path), bufio.NewScanner(f))
+		f.Close()
 		if err != nil {
 			fatalf("%v\n", err)
 		}
 	}
+	for _, err := range l.errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(l.errs) > 0 {
+		fatalf("%d bad lines\n", len(l.errs))
+	}
+	if n := l.merge(os.Stderr); n > 0 {
+		fmt.Fprintf(os.Stderr, "merged %d duplicate words\n", n)
+	}
+	words, encodes := l.words, l.encodes
 	fmt.Fprintf(os.Stderr, "words = %d; codes = %d\n", len(words), len(encodes))
 
-	nBytes, err := writeDict(words, encodes, os.Stdout)
+	md := Metadata{Language: *lang, Variant: *variant, Built: buildTime()}
+	if *indexed {
+		md.Version = indexVersion
+	}
+	if *hashRate != 0 {
+		md.Version, md.FalseRate = hashVersion, *hashRate
+	}
+	if *automaton {
+		md.Version = dawgVersion
+	}
+	for _, path := range flag.Args() {
+		md.Sources = append(md.Sources, filepath.Base(path))
+	}
+	var nBytes int
+	var err error
+	if *legacy {
+		nBytes, err = writeDict(words, encodes, os.Stdout)
+	} else {
+		nBytes, err = writeDictFile(md, words, encodes, os.Stdout)
+	}
 	if err != nil {
 		fatalf("%v\n", err)
 	}
 	fmt.Fprintf(os.Stderr, "output bytes = %d\n", nBytes)
+	if kind := map[int]string{hashVersion: "hashed", dawgVersion: "automaton"}[md.Version]; kind != "" {
+		compact, _ := writeDictFile(Metadata{}, words, encodes, io.Discard)
+		fmt.Fprintf(os.Stderr, "%s: %.1f bits per word, %.0f%% of the %d bytes of the prefix-compressed list\n",
+			kind, 8*float64(nBytes)/float64(len(words)), 100*float64(nBytes)/float64(compact), compact)
+	}
 }
 
-func readWordEncodings(words []dict, encodes []bits, s *bufio.Scanner) ([]dict, []bits, error) {
-	for s.Scan() {
-		line := s.Text()
-		fields := strings.Fields(line)
-		if len(fields) != 2 {
-			return nil, nil, fmt.Errorf("Expected 2 words in a line. Found %d for: \"%v\"\n", len(fields), line)
+// Returns the time the dictionary is built, which is now unless
+// SOURCE_DATE_EPOCH is set for a reproducible build
+func buildTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Compile reads annotated spelling lists, lines of the form
+//
+//	word <tab> affixcode [ , affixcode ] ...
+//
+// and writes their encoding, which NewChecker reads, to w. The counts
+// and version of md are filled in
+func Compile(w io.Writer, md Metadata, lists ...io.Reader) error {
+	var l wordList
+	for i, list := range lists {
+		if err := l.read(fmt.Sprintf("list %d", i+1), bufio.NewScanner(list)); err != nil {
+			return err
+		}
+	}
+	l.merge(io.Discard)
+	_, err := writeDictFile(md, l.words, l.encodes, w)
+	return err
+}
+
+// print the annotated lists held in the encoded dictionaries named by
+// the arguments, or standard input
+func decode() {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if flag.NArg() == 0 {
+		md, err := printWordEncodings(os.Stdin, out)
+		if err != nil {
+			fatalf("%v\n", err)
 		}
-		word := fields[0]
-		affixes := fields[1]
+		os.Stderr.Write(md.marshal())
+	}
 
-		// Find index of bits in encodes, or add if code does not exist
-		code, err := strToCode(affixes) // Equivalent of `typecode` and `codetab`
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
 		if err != nil {
-			return nil, nil, err
+			fatalf("cannot open %s\n%v\n", path, err)
 		}
-		var i int
-		for i = 0; i < len(encodes); i++ {
-			if encodes[i] == code {
-				break
-			}
+		md, err := printWordEncodings(f, out)
+		f.Close()
+		if err != nil {
+			fatalf("%s: %v\n", path, err)
 		}
-		if i == len(encodes) {
-			encodes = append(encodes, code)
+		os.Stderr.Write(md.marshal())
+	}
+}
+
+// Writes the words of the encoded dictionary read from r to w in the
+// annotated form read by readWordEncodings. Returns the metadata of
+// the dictionary
+func printWordEncodings(r io.Reader, w io.Writer) (Metadata, error) {
+	md, words, encodes, err := readDict(r)
+	if err != nil {
+		return md, err
+	}
+	for _, word := range words {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", word.word, codeToNames(encodes[word.i])); err != nil {
+			return md, err
+		}
+	}
+	return md, nil
+}
+
+// Appends the words of the annotated list read from s, and their codes,
+// to words and encodes
+func readWordEncodings(words []dict, encodes []bits, s *bufio.Scanner) ([]dict, []bits, error) {
+	l := wordList{words: words, encodes: encodes, pos: make([]string, len(words))}
+	err := l.read("", s)
+	return l.words, l.encodes, err
+}
+
+// A wordList accumulates the words of annotated spelling lists and
+// where each one was read
+type wordList struct {
+	words   []dict
+	encodes []bits
+	pos     []string // file:line of each word
+
+	keepGoing bool    // read past bad lines
+	errs      []error // the bad lines read past
+}
+
+// Reads the annotated list named name from s. Blank lines and lines
+// starting with # are skipped. A bad line is returned as a ListError,
+// unless keepGoing is set, in which case it is added to errs and
+// skipped
+func (l *wordList) read(name string, s *bufio.Scanner) error {
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		word, code, err := parseEntry(line)
+		if err != nil {
+			err = &ListError{File: name, Line: n, Err: err}
+			if !l.keepGoing {
+				return err
+			}
+			l.errs = append(l.errs, err)
+			continue
 		}
 
 		// Accumulate the encoding index and word
-		words = append(words, dict{word: word, i: uint16(i)})
+		l.words = append(l.words, dict{word: word, i: l.index(code)})
+		l.pos = append(l.pos, fmt.Sprintf("%s:%d", name, n))
+	}
+	return s.Err()
+}
+
+// Returns the word and affix code of a line of an annotated list
+func parseEntry(line string) (string, bits, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return "", 0, fmt.Errorf("%w, found %d fields in %q", ErrFields, len(fields), line)
 	}
-	err := s.Err()
+	word := fields[0]
+	affixes := fields[1]
+	for i := 0; i < len(word); {
+		r, n := utf8.DecodeRuneInString(word[i:])
+		if !isWordRune(r) && r != '&' {
+			return "", 0, fmt.Errorf("%w: %q in %q", ErrWordChar, word[i:i+n], word)
+		}
+		i += n
+	}
+	word = norm.NFC.String(word)
+	code, err := strToCode(affixes) // Equivalent of `typecode` and `codetab`
+	return word, code, err
+}
+
+// Returns the index of code in encodes, adding it if it does not exist
+func (l *wordList) index(code bits) int {
+	for i, c := range l.encodes {
+		if c == code {
+			return i
+		}
+	}
+	l.encodes = append(l.encodes, code)
+	return len(l.encodes) - 1
+}
+
+// Merges the entries of words listed more than once, in the order
+// read, and drops the codes no longer used. Conflicts are reported to
+// w. Returns the number of entries merged away
+func (l *wordList) merge(w io.Writer) int {
+	order := make([]int, len(l.words))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return l.words[order[i]].word < l.words[order[j]].word
+	})
+
+	var words []dict
+	var codes []bits
+	var pos []string
+	for _, k := range order {
+		word, code := l.words[k], l.encodes[l.words[k].i]
+		last := len(words) - 1
+		if last < 0 || words[last].word != word.word {
+			words, codes, pos = append(words, word), append(codes, code), append(pos, l.pos[k])
+			continue
+		}
+		merged, ok := mergeCodes(codes[last], code)
+		if !ok {
+			fmt.Fprintf(w, "%s: %s: %s conflicts with %s: %s; using %s\n", l.pos[k], word.word,
+				codeToNames(code), pos[last], codeToNames(codes[last]), codeToNames(merged))
+		}
+		codes[last], pos[last] = merged, l.pos[k]
+	}
+
+	n := len(l.words) - len(words)
+	used := make(map[bits]bool)
+	for _, code := range codes {
+		used[code] = true
+	}
+	encodes := l.encodes[:0]
+	for _, code := range l.encodes {
+		if used[code] {
+			encodes = append(encodes, code)
+		}
+	}
+	l.words, l.encodes, l.pos = words, encodes, pos
+	for i, code := range codes {
+		l.words[i].i = l.index(code)
+	}
+	return n
+}
 
-	return words, encodes, err
+// Returns the code of a word listed with codes a and then b. Affix
+// classes are or-ed, and a stop list entry overrides any other. Returns
+// false if a and b disagree on the modifiers restricting affixes
+// (nopref, mono, in and DONT_TOUCH), in which case those of b are used
+func mergeCodes(a, b bits) (bits, bool) {
+	const modifiers = NOPREF | DONT_TOUCH | MONO | IN
+	switch {
+	case isSet(a, STOP) != isSet(b, STOP):
+		if isSet(a, STOP) {
+			return a, true
+		}
+		return b, true
+	case a&modifiers != b&modifiers:
+		return a&^modifiers | b, false
+	}
+	return a | b, true
 }
 
 func sread(b *bufio.Reader) (uint16, error) {
@@ -122,19 +369,25 @@ func lput(b *bufio.Writer, bits uint32) error {
 
 // spit out the encoded dictionary
 // all numbers are encoded big-endian.
-// struct {
-//   ncodes  uint16
-//   encodes [ncodes]bits
-//   []struct{
-//     encode uint16
-//     word   []uint16
-//   }
-// }
+//
+//	struct {
+//	  ncodes  uint16
+//	  encodes [ncodes]bits
+//	  []struct{
+//	    encode uint16
+//	    word   []uint16
+//	  }
+//	}
+//
 // bit mask (for encode uint16) is:
 // 0x8000 flag for code word
 // 0x7800 count of number of common bytes with previous word
 // 0x07ff index into codes array for affixes
+// Words that do not fit (see checkLegacy) are refused with ErrLegacy
 func writeDict(words []dict, encodes []bits, w io.Writer) (int, error) {
+	if err := checkLegacy(words, encodes); err != nil {
+		return 0, err
+	}
 	sort.Slice(words, func(i, j int) bool {
 		return words[i].word < words[j].word
 	})
@@ -161,13 +414,14 @@ func writeDict(words []dict, encodes []bits, w io.Writer) (int, error) {
 			fmt.Fprintf(os.Stderr, "identical words: %s\n", word.word)
 		}
 
-		// j must fit inside 4 bits. 2^4-1 == 15
+		// j must fit inside 4 bits. 2^4-1 == 15. The rest of the
+		// word is written in full, so clamping loses nothing
 		if j > 15 {
 			j = 15
 		}
 
 		// LSB: Code Index (11 bits) | Common char count (4 bits) | High (1 bit)
-		c := (word.i & uint16(0x07FF)) | uint16(((j<<11)&0x7800)|((1<<15)&0x8000))
+		c := uint16(word.i&0x07FF) | uint16(((j<<11)&0x7800)|((1<<15)&0x8000))
 		if err := sput(f, c); err != nil {
 			return nBytes, err
 		}
@@ -186,6 +440,23 @@ func writeDict(words []dict, encodes []bits, w io.Writer) (int, error) {
 	return nBytes, nil
 }
 
+// Returns an error wrapping ErrLegacy if words and encodes cannot be
+// written by writeDict without loss: code indexes have 11 bits and
+// bytes with the high bit set would be taken for entry headers
+func checkLegacy(words []dict, encodes []bits) error {
+	if len(encodes) > 0x0800 {
+		return fmt.Errorf("%w: %d codes, at most %d fit", ErrLegacy, len(encodes), 0x0800)
+	}
+	for _, word := range words {
+		for i := 0; i < len(word.word); i++ {
+			if word.word[i]&0x80 != 0 {
+				return fmt.Errorf("%w: %q is not ASCII", ErrLegacy, word.word)
+			}
+		}
+	}
+	return nil
+}
+
 // layout of file entry: first byte has bit 0x80 turned on.
 // next 4 bits count number of characters common between this
 // entry and previous one.  last three bits concatenated with
@@ -193,100 +464,71 @@ func writeDict(words []dict, encodes []bits, w io.Writer) (int, error) {
 // bit is zero in all bytes but the first. 3rd and following
 // bytes are the remainder of the dictionary word.
 //
-// layout in memory: common prefixes are expanded, and the
-// first two letters of each word are deleted and found
-// instead by lookup in table spacep, which points to the
-// first word for each two-letter prefix.
-func readDict(path string) ([]dict, [128 * 128]*dict) {
-	f, err := os.Open(path)
-	if err != nil {
-		fatalf("spell: cannot open %s\n", path)
-	}
-	defer f.Close()
-
-	r := bufio.NewReader(f)
+// Returns the encodings given the output of writeDict, passing each
+// word and the index of its encoding, in order, to add. The word is
+// only valid during the call. Performs the opposite operation of
+// writeDict. Errors are DictErrors
+func decodeDict(rd io.Reader, add func(word []byte, i int)) ([]bits, error) {
+	r := bufio.NewReader(rd)
+	var off int64 // offset in rd of the header or entry being read
 
 	nencode16, err := sread(r)
 	if err != nil {
-		fatalf("spell: trouble reading %s\n", path)
+		return nil, dictError(off, "", err)
 	}
 	nencode := int(nencode16)
 	encodes := make([]bits, nencode)
 	for i := 0; i < nencode; i++ {
 		code, err := lread(r)
-		encodes[i] = bits(code)
 		if err != nil {
-			fatalf("spell: trouble reading %s\n", path)
+			return nil, dictError(off, "", err)
 		}
+		encodes[i] = bits(code)
 	}
+	off = 2 + 4*int64(nencode)
 
-	space := make([]dict, 0, nencode) // sorted words (first two letters deleted)
-	var spacep [128 * 128]*dict       // pointer to words starting with "xx"
-
-	var lasts *string // previous word
-	var s *string     // current word
+	var word, last []byte // this word and the previous one
 
-	sp := -1 // previous index into spacep
-	i := 0   // current index into spacep
-
-	for err == nil {
+	for {
 		head, err := sread(r) // LSB 11b | 4b | 1b MSB for index and repeated chars
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return nil, dictError(off, string(last), err)
+		}
+		i := int(head) & 0x07FF         // encodes index lookup
 		j := (int(head) & 0x7800) >> 11 // num repeated chars (called p in v10 src)
-
-		space = append(space, dict{i: head, word: ""})
-		d := &space[len(space)-1]
-		s = &d.word
-
-		// Need to update the spacep prefix mapping if the number of repeated
-		// characters is less than two. TODO: What happens if word has only 1 char?
-		if j <= 0 { // invariant: j >= 0
-			c, err := r.ReadByte()
-			if err != nil {
-				break
-			}
-			i = int(c) * 128 // Points first x in "xx"
+		if head&0x8000 == 0 || j > len(last) {
+			return nil, dictError(off, string(last), ErrBadEntry)
 		}
-		if j <= 1 {
-			c, err := r.ReadByte()
-			if err != nil {
-				break
-			}
-			if c&0x80 == 0 { // works since c is ASCII otherwise is 11b|4b|1b enc
-				i = i/128*128 + int(c) // Points second x in "xx"
-			}
-			if i <= sp {
-				fatalf("spell: the dict isn't sorted")
-			}
-			for sp < i {
-				sp++
-				spacep[sp] = d
-			}
-		} // else j >= 2 therefore sp already points to correct "xx" location
-
-		// copy repeated chars (can skip first 2 which are "xx" index in spacep)
-		*s += (*lasts)[:j-2]
 
-		// copy non-repeated chars
+		// copy repeated chars, then non-repeated chars up to the next entry
+		word = append(word[:0], last[:j]...)
 		for {
 			c, err := r.ReadByte()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				break // breaks two loops since err != nil
+				return nil, dictError(off, string(last), err)
 			}
 			if c&0x80 != 0 { // Not ASCII; part of the encoding
-				err = r.UnreadByte()
+				r.UnreadByte()
 				break
 			}
-			*s += string(c)
+			word = append(word, c)
 		}
-
-		lasts = s
-	}
-	if err != io.EOF {
-		fatalf("spell: trouble reading %s\n%v", path, err)
+		if i >= nencode {
+			return nil, dictError(off, string(word), ErrBadCode)
+		}
+		if bytes.Compare(word, last) < 0 {
+			return nil, dictError(off, string(word), ErrUnsorted)
+		}
+		off += 2 + int64(len(word)-j)
+		add(word, i)
+		word, last = last, word
 	}
 
-	return space, spacep
+	return encodes, nil
 }
@@ -3,10 +3,10 @@ package spell
 import (
 	"bufio"
 	"bytes"
-	"fmt"
-	"io"
+	"errors"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -43,74 +43,116 @@ func TestWriteDict(t *testing.T) {
 		t.Fatalf("writeDict nBytes != buf.Len(). (%d != %d)", nBytes, buf.Len())
 	}
 
-	wordsPrime, encodesPrime, err := readDictTesting(&buf)
+	var wordsPrime []dict
+	encodesPrime, err := decodeDict(&buf, func(word []byte, i int) {
+		wordsPrime = append(wordsPrime, dict{i: i, word: string(word)})
+	})
 	if err != nil {
-		t.Fatalf("readDictTesting err: %v", err)
+		t.Fatalf("decodeDict err: %v", err)
 	}
 	if !reflect.DeepEqual(words, wordsPrime) {
-		t.Fatalf("input of writeDict != output of readDictTesting (words)")
+		t.Fatalf("input of writeDict != output of decodeDict (words)")
 	}
 	if !reflect.DeepEqual(encodes, encodesPrime) {
-		t.Fatalf("input of writeDict != output of readDictTesting (encodes)")
+		t.Fatalf("input of writeDict != output of decodeDict (encodes)")
 	}
 	t.Logf("[INFO] %d words and %d encodings\n", len(words), len(encodes))
 }
 
-// Returns words and encodings given the output of writeDict
-// Performs the opposite operation of writeDict. For testing purposes
-func readDictTesting(rd io.Reader) ([]dict, []bits, error) {
-	r := bufio.NewReader(rd)
-
-	nencode16, err := sread(r)
-	if err != nil {
-		return nil, nil, err
+func TestMergeCodes(t *testing.T) {
+	tests := []struct {
+		a, b bits
+		want bits
+		ok   bool
+	}{
+		{NOUN, VERB, NOUN | VERB, true},
+		{NOUN, NOUN, NOUN, true},
+		{NOUN | ADJ, STOP, STOP, true},
+		{STOP, NOUN, STOP, true},
+		{STOP, STOP | NOUN, STOP | NOUN, true},
+		{NOUN, NOUN | NOPREF, NOUN | NOPREF, false},
+		{VERB | MONO, NOUN, VERB | NOUN, false},
 	}
-	nencode := int(nencode16)
-	encodes := make([]bits, nencode)
-	for i := 0; i < nencode; i++ {
-		code, err := lread(r)
-		encodes[i] = bits(code)
-		if err != nil {
-			return nil, nil, err
+	for _, test := range tests {
+		got, ok := mergeCodes(test.a, test.b)
+		if got != test.want || ok != test.ok {
+			t.Errorf("mergeCodes(%s, %s) = %s, %v, want %s, %v", codeToStr(test.a), codeToStr(test.b),
+				codeToStr(got), ok, codeToStr(test.want), test.ok)
 		}
 	}
+}
 
-	words := make([]dict, 0, nencode) // At least nencode words
-	var last string = ""
-
-	for {
-		c, err := sread(r)
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return nil, nil, err
-			}
+func TestWordListMerge(t *testing.T) {
+	var l wordList
+	lists := []struct{ name, text string }{
+		{"list", "cat\tn\ndog\tn\nrun\tv\n"},
+		{"local", "dog\tv\nrun\tv,nopref\nzap\tv\n"},
+		{"stop", "cat\ts\n"},
+	}
+	for _, list := range lists {
+		if err := l.read(list.name, bufio.NewScanner(strings.NewReader(list.text))); err != nil {
+			t.Fatal(err)
 		}
-		i := uint16(c & 0x07FF) // encodes index lookup
-		j := (c & 0x7800) >> 11 // length of common prefix with previous word
-		if c&0x8000 == 0 {
-			return nil, nil, fmt.Errorf("Invariant violation. 0x8000 should be high")
+	}
+	var report bytes.Buffer
+	if n := l.merge(&report); n != 3 {
+		t.Errorf("merged %d words, want 3", n)
+	}
+	want := map[string]bits{"cat": STOP, "dog": NOUN | VERB, "run": VERB | NOPREF, "zap": VERB}
+	if len(l.words) != len(want) {
+		t.Errorf("words = %v", l.words)
+	}
+	for _, word := range l.words {
+		if got := l.encodes[word.i]; got != want[word.word] {
+			t.Errorf("%s: %s, want %s", word.word, codeToStr(got), codeToStr(want[word.word]))
 		}
+	}
+	if len(l.encodes) != len(want) {
+		t.Errorf("encodes = %v, want %d codes", l.encodes, len(want))
+	}
+	if got := report.String(); got != "local:2: run: v,nopref conflicts with list:3: v; using v,nopref\n" {
+		t.Errorf("report = %q", got)
+	}
+}
 
-		remainder := ""
-		b, err := r.ReadByte()
-		for ; b&0x80 == 0 && err == nil; b, err = r.ReadByte() {
-			remainder += string(b)
-		}
-		if err != nil && err != io.EOF {
-			return nil, nil, err
-		}
-		if b&0x80 != 0 {
-			if err := r.UnreadByte(); err != nil {
-				return nil, nil, err
-			}
+func TestWordListReadErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+		err  error
+	}{
+		{"cat\tn\ndog\n", 2, ErrFields},
+		{"cat\tn extra\n", 1, ErrFields},
+		{"# comment\n\ncaf\xe9\tn\n", 3, ErrWordChar},
+		{"caf\xc3\xa9!\tn\n", 1, ErrWordChar},
+		{"a-b\tn\n", 1, ErrWordChar},
+		{"cat\tn,zz\n", 1, ErrAffixCode},
+		{"cat\tn,\n", 1, ErrAffixCode},
+	}
+	for _, test := range tests {
+		var l wordList
+		err := l.read("list", bufio.NewScanner(strings.NewReader(test.text)))
+		var le *ListError
+		if !errors.As(err, &le) || le.File != "list" || le.Line != test.line || !errors.Is(err, test.err) {
+			t.Errorf("%q: err = %v, want list:%d: %v", test.text, err, test.line, test.err)
 		}
-
-		word := last[:j] + remainder
-		words = append(words, dict{word: word, i: i})
-		last = word
 	}
+}
 
-	return words, encodes, nil
+func TestWordListReadKeepGoing(t *testing.T) {
+	l := wordList{keepGoing: true}
+	text := "# words\ncat\tn\ndog\n\nAT&T\tpc,nopref\nrun\tq\nisn't\tn\n"
+	if err := l.read("local", bufio.NewScanner(strings.NewReader(text))); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, err := range l.errs {
+		got = append(got, err.Error()[:len("local:0")])
+	}
+	if want := []string{"local:3", "local:6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("errors at %v, want %v", got, want)
+	}
+	if len(l.words) != 3 || l.pos[2] != "local:7" {
+		t.Errorf("words = %v at %v", l.words, l.pos)
+	}
 }
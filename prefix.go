@@ -1,59 +1,105 @@
 package spell
 
-var prefixes []prefix = []prefix{
-	{"anti", 0},
-	{"auto", 0},
-	{"bio", 0},
-	{"counter", 0},
-	{"dis", 0},
-	{"electro", 0},
-	{"femto", 0},
-	{"geo", 0},
-	{"giga", 0},
-	{"hyper", 0},
-	{"im", IN},
-	{"immuno", 0},
-	{"in", IN},
-	{"inter", 0},
-	{"intra", 0},
-	{"ir", IN},
-	{"iso", 0},
-	{"kilo", 0},
-	{"magneto", 0},
-	{"mega", 0},
-	{"meta", 0},
-	{"micro", 0},
-	{"mid", 0},
-	{"milli", 0},
-	{"mini", 0},
-	{"mis", 0},
-	{"mono", 0},
-	{"multi", 0},
-	{"nano", 0},
-	{"neuro", 0},
-	{"non", 0},
-	{"out", 0},
-	{"over", 0},
-	{"para", 0},
-	{"photo", 0},
-	{"pico", 0},
-	{"poly", 0},
-	{"pre", 0},
-	{"pseudo", 0},
-	{"psycho", 0},
-	{"quasi", 0},
-	{"radio", 0},
-	{"re", 0},
-	{"semi", 0},
-	{"stereo", 0},
-	{"sub", 0},
-	{"super", 0},
-	{"tele", 0},
-	{"thermo", 0},
-	{"ultra", 0},
-	{"under", 0}, /*must precede un*/
-	{"un", IN},
+import "fmt"
+
+// Returns true if the affix classes h of a stem satisfy flag. A stem
+// looked up with MONO must also be MONO (fib -> fibbing)
+func fits(h, flag bits) bool {
+	return isSet(h, flag&^MONO) && flag&MONO <= h&MONO
+}
+
+// look up q.word[bp:ep] in the spelling list. A stem looked up with
+// MONO lost its doubled final consonant, which is a derivation level.
+// One-letter words (a, I) are found only as themselves, never as stems
+func (q *query) tryword(bp, ep int, lev int, flag bits) bits {
+	if ep-bp < 1 || ep-bp == 1 && (bp > 0 || ep < q.n) {
+		return 0
+	}
+	if isSet(flag, MONO) {
+		lev++
+		q.setDeriv(lev, dSUFF, "+"+string(q.at(ep)))
+	}
+	h := q.dict(q.word[bp:ep])
+	if q.x != nil {
+		if h == 0 {
+			fmt.Fprintf(q.x, "=%s\n", q.word[bp:ep])
+		} else {
+			fmt.Fprintf(q.x, "=%s %s\n", q.word[bp:ep], codeToStr(h))
+		}
+	}
+	if fits(h, flag) {
+		q.record(lev)
+	}
+	return h
+}
+
+// look up the stem q.word[:ep], which was derived by the affix a,
+// first as it stands and then with prefixes stripped off
+func (q *query) trypref(ep int, a string, lev int, flag bits) bits {
+	if a == "." {
+		q.setDeriv(lev, dNONE, "")
+	} else {
+		q.setDeriv(lev, dSUFF, a)
+	}
+	h := q.tryword(0, ep, lev, flag)
+	if fits(h, flag) {
+		return h
+	}
+	return q.strippref(0, ep, lev, flag, 0)
 }
 
-// TODO: Sort prefix alphabetically with shorter words coming after
-// Not sure why under before un yet inter is after in
+// strip a prefix from q.word[bp:ep] and look up the rest, stacking at
+// most dLEV prefixes (un+re+constructed). NOPREF stems refuse prefixes
+// and in-, im-, ir- must go directly on an IN word
+func (q *query) strippref(bp, ep int, lev int, flag bits, npref int) bits {
+	if npref >= dLEV {
+		return 0
+	}
+	for _, p := range q.pref {
+		cp := bp + len(p.s)
+		if cp > ep || string(q.word[bp:cp]) != p.s || !hasVowel(q.word[cp:ep]) {
+			continue
+		}
+		q.setDeriv(lev+1, dPREF, p.s+"+")
+		h := q.tryword(cp, ep, lev+1, flag)
+		if isSet(h, NOPREF) || isSet(p.flag, IN) && !inun(p.s, q.word[cp], h) {
+			continue
+		}
+		if fits(h, flag) {
+			return h
+		}
+		if h = q.strippref(cp, ep, lev+1, flag, npref+1); h != 0 {
+			return h
+		}
+	}
+	return 0
+}
+
+// Returns true if the IN class prefix p may go on a stem beginning with
+// c and having affix classes h (0 if the stem is not a word): un- only
+// on stems that are not IN, and in-, im-, ir- only on IN words,
+// assimilated to c (irregular, impossible)
+func inun(p string, c byte, h bits) bool {
+	if p[0] == 'u' {
+		return !isSet(h, IN)
+	}
+	if !isSet(h, IN) {
+		return false
+	}
+	switch c {
+	case 'r':
+		return p == "ir"
+	case 'm', 'p':
+		return p == "im"
+	}
+	return p == "in"
+}
+
+func hasVowel(w []byte) bool {
+	for _, c := range w {
+		if isVowel(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package spell
+
+import "testing"
+
+func TestTrypref(t *testing.T) {
+	dict := testDict(t,
+		"AAA	pc,nopref",
+		"construct	v,ion,er,va",
+		"dog	n,v,na,ms,y",
+		"mortal	n,a,in",
+		"possible	a,va,in",
+		"read	n,vi,er,va",
+		"regular	n,a,na,in",
+		"therapy	n",
+	)
+	tests := []struct {
+		word string
+		ok   bool
+	}{
+		{"underdog", true},
+		{"unreadable", true},
+		{"reread", true},
+		{"rereading", true},
+		{"immunotherapy", true},
+		{"impossible", true},
+		{"inpossible", false},
+		{"unpossible", false},
+		{"irregular", true},
+		{"inregular", false},
+		{"immortal", true},
+		{"unmortal", false},
+		{"unreconstructed", true},
+		{"ununreconstructed", false},
+		{"antiAAA", false},
+		{"undog", true},
+	}
+	for _, test := range tests {
+		h := derive(dict, test.word)
+		if ok := h != 0 && !isSet(h, STOP); ok != test.ok {
+			t.Errorf("%s: got %v, want %v (code %#x)", test.word, ok, test.ok, h)
+		}
+	}
+}
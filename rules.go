@@ -0,0 +1,208 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Rules are the suffix and prefix rules by which a Checker derives
+// words from its spelling list, as read from a rule file. The default
+// rules, those of v10spell, are in dictionaries/rules, which describes
+// the format
+type Rules struct {
+	suf  []suffix
+	pref []prefix
+
+	sufLine, prefLine []int   // lines of the rules in the file read
+	keepGoing         bool    // read past bad lines
+	errs              []error // the bad lines read past
+}
+
+// The rules of v10spell, read from the embedded dictionaries/rules
+var suffixes, prefixes = defaultRules()
+
+func defaultRules() ([]suffix, []prefix) {
+	data, err := dictionaries.ReadFile("dictionaries/rules")
+	if err != nil {
+		panic(err)
+	}
+	var r Rules
+	if err := r.read("dictionaries/rules", bufio.NewScanner(bytes.NewReader(data))); err != nil {
+		panic(err)
+	}
+	return r.suf, r.pref
+}
+
+// DefaultRules returns the affix rules of v10spell, which Checkers use
+// unless given others
+func DefaultRules() *Rules {
+	return &Rules{suf: suffixes, pref: prefixes}
+}
+
+// ReadRules returns the affix rules of the rule file read from r. A bad
+// line is returned as a RuleError
+func ReadRules(r io.Reader) (*Rules, error) {
+	var rules Rules
+	if err := rules.read("", bufio.NewScanner(r)); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// LoadRules returns the affix rules of the named rule file
+func LoadRules(path string) (*Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules Rules
+	if err := rules.read(path, bufio.NewScanner(f)); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// Reads the rule file name from s, appending its rules to r. Blank
+// lines and lines starting with # are skipped. A bad line is returned
+// as a RuleError, unless keepGoing is set, in which case it is added to
+// errs and skipped
+func (r *Rules) read(name string, s *bufio.Scanner) error {
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		nsuf, npref := len(r.suf), len(r.pref)
+		if err := r.parse(strings.Fields(line)); err != nil {
+			err = &RuleError{File: name, Line: n, Err: err}
+			if !r.keepGoing {
+				return err
+			}
+			r.errs = append(r.errs, err)
+			continue
+		}
+		if len(r.suf) > nsuf {
+			r.sufLine = append(r.sufLine, n)
+		}
+		if len(r.pref) > npref {
+			r.prefLine = append(r.prefLine, n)
+		}
+	}
+	return s.Err()
+}
+
+// Appends the rule of the fields of a line to r
+func (r *Rules) parse(f []string) error {
+	switch {
+	case f[0] == "prefix" && len(f) == 3:
+		flag, err := ruleClasses(f[2])
+		if err != nil {
+			return err
+		}
+		r.pref = append(r.pref, prefix{f[1], flag})
+		return nil
+	case f[0] == "suffix" && (len(f) == 8 || len(f) == 12):
+	default:
+		return ErrRuleFields
+	}
+	t := suffix{s: f[1], p2: nop}
+	var err error
+	if t.p1, t.n1, err = ruleOp(t.s, f[2], f[3], f[4]); err != nil {
+		return err
+	}
+	t.d1, t.a1 = ruleString(f[4]), ruleString(f[5])
+	if t.flag, err = ruleClasses(f[6]); err != nil {
+		return err
+	}
+	if t.affixable, err = ruleClasses(f[7]); err != nil {
+		return err
+	}
+	if len(f) == 12 {
+		if t.p2, t.n2, err = ruleOp(t.s, f[8], f[9], f[10]); err != nil {
+			return err
+		}
+		t.d2, t.a2 = ruleString(f[10]), ruleString(f[11])
+	}
+	r.suf = append(r.suf, t)
+	return nil
+}
+
+// Returns the op named name and the number of bytes n of the suffix s
+// it removes. A subst op may have n -1, lengthening the stem by a byte
+// (-ogram for -ograph), which is the room newQuery leaves, and needs a
+// deletion and addition d
+func ruleOp(s, name, n, d string) (op, int, error) {
+	p, ok := opCodes[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w %q", ErrRuleOp, name)
+	}
+	least := 0
+	if name == "subst" {
+		least = -1
+	}
+	k, err := strconv.Atoi(n)
+	if err != nil || k < least || k > len(s) {
+		return nil, 0, fmt.Errorf("%w: length %s of suffix %q", ErrRuleFields, n, s)
+	}
+	if name == "subst" {
+		minus, plus := strings.IndexByte(d, '-'), strings.IndexByte(d, '+')
+		if minus < 0 || plus < minus {
+			return nil, 0, fmt.Errorf("%w: subst needs -del+add, not %q", ErrRuleFields, d)
+		}
+	}
+	return p, k, nil
+}
+
+// Returns the name of p in opCodes
+func opName(p op) string {
+	for name, q := range opCodes {
+		if reflect.ValueOf(q).Pointer() == reflect.ValueOf(p).Pointer() {
+			return name
+		}
+	}
+	return "?"
+}
+
+// Returns the string of a rule field, - standing for the empty string
+func ruleString(f string) string {
+	if f == "-" {
+		return ""
+	}
+	return f
+}
+
+// Returns the affix classes of a rule field: - for none, else names
+// as in the annotated lists or numbers, separated by commas
+func ruleClasses(f string) (bits, error) {
+	if f == "-" {
+		return 0, nil
+	}
+	var code bits
+	for _, name := range strings.Split(f, ",") {
+		if b, ok := nameCodes[name]; ok {
+			code |= b
+		} else if v, err := strconv.ParseUint(name, 0, 32); err == nil {
+			code |= bits(v)
+		} else {
+			return 0, fmt.Errorf("%w %q", ErrAffixCode, name)
+		}
+	}
+	return code, nil
+}
+
+// SetRules makes c derive words by rules instead of those it has. A
+// British Checker still takes -ise for -ize. It must not be called while
+// c is in use
+func (c *Checker) SetRules(rules *Rules) {
+	c.suf, c.pref = rules.suf, rules.pref
+	if c.british {
+		c.suf = ise(c.suf)
+	}
+}
@@ -0,0 +1,146 @@
+package spell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRules(t *testing.T) {
+	text := "# test rules\n\nsuffix ed strip 1 - +d ed a,comp i_to_y 2 -y+ied +ed\n" +
+		"suffix est\tstrip 2 - +st 0x20 d\nsuffix ogram subst -1 -ph+m - n n\nprefix un in\nprefix re -\n"
+	r, err := ReadRules(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.suf) != 3 || len(r.pref) != 2 {
+		t.Fatalf("%d suffixes and %d prefixes, want 3 and 2", len(r.suf), len(r.pref))
+	}
+	ed := r.suf[0]
+	if ed.s != "ed" || opName(ed.p1) != "strip" || ed.n1 != 1 || ed.d1 != "" || ed.a1 != "+d" ||
+		ed.flag != ED || ed.affixable != ADJ|COMP ||
+		opName(ed.p2) != "i_to_y" || ed.n2 != 2 || ed.d2 != "-y+ied" || ed.a2 != "+ed" {
+		t.Errorf("ed = %+v", ed)
+	}
+	if est := r.suf[1]; est.flag != EST || est.affixable != DONT_TOUCH || opName(est.p2) != "nop" {
+		t.Errorf("est = %+v", est)
+	}
+	if ogram := r.suf[2]; ogram.n1 != -1 || ogram.d1 != "-ph+m" {
+		t.Errorf("ogram = %+v", ogram)
+	}
+	if !reflect.DeepEqual(r.pref, []prefix{{"un", IN}, {"re", 0}}) {
+		t.Errorf("prefixes = %v", r.pref)
+	}
+}
+
+func TestReadRulesErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+		err  error
+	}{
+		{"prefix un\n", 1, ErrRuleFields},
+		{"# c\nsuffix s s 1 - +s n,vi\n", 2, ErrRuleFields},
+		{"infix s -\n", 1, ErrRuleFields},
+		{"suffix s strop 1 - +s n d\n", 1, ErrRuleOp},
+		{"suffix s s 1 - +s n d nop 0 -\n", 1, ErrRuleFields},
+		{"suffix s s x - +s n d\n", 1, ErrRuleFields},
+		{"suffix s s 2 - +s n d\n", 1, ErrRuleFields},
+		{"suffix s s -2 - +s n d\n", 1, ErrRuleFields},
+		{"suffix ab bility -1 - - n n\n", 1, ErrRuleFields},
+		{"suffix nce subst 1 +ce - a n\n", 1, ErrRuleFields},
+		{"prefix re\t-\n\nsuffix s s 1 - +s noun d\n", 3, ErrAffixCode},
+		{"prefix in in,\n", 1, ErrAffixCode},
+	}
+	for _, test := range tests {
+		_, err := ReadRules(strings.NewReader(test.text))
+		var re *RuleError
+		if !errors.As(err, &re) || re.Line != test.line || !errors.Is(err, test.err) {
+			t.Errorf("%q: err = %v, want line %d: %v", test.text, err, test.line, test.err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(path, []byte("prefix re -\nprefix\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadRules(path)
+	if err == nil || err.Error() != path+":2: "+ErrRuleFields.Error() {
+		t.Errorf("LoadRules err = %v", err)
+	}
+}
+
+// Rules that load check any word without going outside the stem buffer
+func TestRulesBounds(t *testing.T) {
+	c := testChecker(t, Metadata{}, "a\tn,v\nab\tn,v\nb\tn,v\ned\tn,v\ne\tn,v\n")
+	words := []string{"ab", "xab", "aab", "b", "ed", "eed", "a", "e", "Ab", "Ed", "abab", "xed", "ied"}
+	for name := range opCodes {
+		for _, text := range []string{
+			"suffix ab %[1]s %[2]d - - n n\n",
+			"suffix ed strip 1 - +d ed a,comp %[1]s %[2]d - +ed\n",
+			"suffix b %[1]s %[2]d - - n,v n,v\n",
+		} {
+			for n := -1; n <= 2; n++ {
+				line := fmt.Sprintf(text, name, n)
+				if name == "subst" {
+					line = strings.Replace(line, " - ", " -b+ab ", 1)
+				}
+				r, err := ReadRules(strings.NewReader(line))
+				if err != nil {
+					continue
+				}
+				c.SetRules(r)
+				for _, word := range words {
+					func() {
+						defer func() {
+							if err := recover(); err != nil {
+								t.Errorf("%q: Check(%q) panics: %v", line, word, err)
+							}
+						}()
+						c.Check(word)
+					}()
+				}
+			}
+		}
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	data, err := dictionaries.ReadFile("dictionaries/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string // the default rules without -ness and un-
+	for _, line := range strings.Split(string(data), "\n") {
+		if f := strings.Fields(line); len(f) < 2 || f[1] != "ness" && f[1] != "un" {
+			kept = append(kept, line)
+		}
+	}
+	r, err := ReadRules(strings.NewReader(strings.Join(kept, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, british := range []bool{false, true} {
+		c, err := American()
+		if british {
+			c, err = British()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetRules(r)
+		for word, want := range map[string]bool{"happiness": false, "unreadable": false, "rereading": true, "realise": british} {
+			if got := c.Check(word); got != want {
+				t.Errorf("british %v: Check(%q) = %v, want %v", british, word, got, want)
+			}
+		}
+		c.SetRules(DefaultRules())
+		if !c.Check("happiness") || !c.Check("unreadable") {
+			t.Errorf("british %v: default rules not restored", british)
+		}
+	}
+}
@@ -6,11 +6,15 @@ package spell
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
+	"fmt"
+	"io"
 	"os"
-	"os/user"
-	"path"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type prefix struct {
@@ -32,6 +36,168 @@ type suffix struct {
 	a2        string
 }
 
+// query is the state of a single word lookup, the global word buffer
+// of sprog.c. Ops rewrite the tail of word in place while stripping
+// suffixes, so a query must not be shared between goroutines.
+type query struct {
+	orig string              // word as given
+	n    int                 // length of the spelling of the word in word
+	word []byte              // stem buffer, padded past the end of the word
+	dict func(w []byte) bits // affix classes of w in the spelling list, 0 if absent
+	suf  []suffix            // suffix rules, ordered as suffixes
+	pref []prefix            // prefix rules, ordered as prefixes
+	x    io.Writer           // if not nil, every stem looked up is printed on x
+
+	deriv     []derivation // affix stripped at each level
+	affix     string       // last derivation found, as printed by -v
+	suffcount int          // suffixes stripped in the last derivation found
+	prefcount int          // prefixes stripped in the last derivation found
+}
+
+// a level of the derivation of a word
+type derivation struct {
+	kind int    // dNONE, dSUFF or dPREF
+	mesg string // affix as printed by -v: +ness, -y+iness, un+
+}
+
+// kinds of derivation levels
+const (
+	dNONE = iota // the word itself
+	dSUFF        // a suffix was stripped
+	dPREF        // a prefix was stripped
+)
+
+// Returns a query for w. The buffer has room for ops such as subst that
+// lengthen the stem (hologram -> holograph)
+func newQuery(w string, dict func(w []byte) bits) *query {
+	q := &query{orig: w, dict: dict, suf: suffixes, pref: prefixes}
+	q.respell(w)
+	return q
+}
+
+// Puts the spelling w of the word in the buffer, which may change its
+// length (the lower case of the Kelvin sign is one byte)
+func (q *query) respell(w string) {
+	q.word = make([]byte, len(w)+2)
+	copy(q.word, w)
+	q.n = len(w)
+}
+
+// Records the affix mesg of the given kind stripped at level lev
+func (q *query) setDeriv(lev int, kind int, mesg string) {
+	for len(q.deriv) <= lev {
+		q.deriv = append(q.deriv, derivation{})
+	}
+	q.deriv[lev] = derivation{kind, mesg}
+}
+
+// Remembers the derivation through levels 1 to lev as the one that
+// found the word. Later derivations replace it. Prefixes come first,
+// outermost first, then suffixes, innermost first: +p+y-y+iness for
+// happiness, un+re+d for unrecognized
+func (q *query) record(lev int) {
+	affix := make([]byte, 0, dLEV*dSIZ)
+	q.suffcount, q.prefcount = 0, 0
+	for j := 1; j <= lev && j < len(q.deriv); j++ {
+		if q.deriv[j].kind == dPREF {
+			q.prefcount++
+			affix = append(affix, q.deriv[j].mesg...)
+		}
+	}
+	for j := lev; j > 0 && j < len(q.deriv); j-- {
+		if q.deriv[j].kind != dSUFF {
+			continue
+		}
+		q.suffcount++
+		mesg := q.deriv[j].mesg
+		if len(affix) > 0 && affix[len(affix)-1] == '+' && strings.HasPrefix(mesg, "+") {
+			mesg = mesg[1:]
+		}
+		affix = append(affix, mesg...)
+	}
+	q.affix = string(affix)
+}
+
+// Returns the Checker the -f, -b and -r flags of a command select: the
+// list compiled by pcode at path, or else the annotated lists named by
+// lists compiled in memory, or else the built-in American or British
+// list. If british is set -ise is taken for -ize, and if rules is not ""
+// the rules are loaded from that file
+func openChecker(path string, british bool, rules string, lists ...string) (*Checker, error) {
+	var c *Checker
+	var err error
+	switch {
+	case path != "":
+		c, err = Open(path)
+	case len(lists) > 0:
+		c, err = compileLists(lists)
+	case british:
+		c, err = British()
+	default:
+		c, err = American()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if british && !c.british {
+		c.ise()
+	}
+	if rules != "" {
+		r, err := LoadRules(rules)
+		if err != nil {
+			return nil, err
+		}
+		c.SetRules(r)
+	}
+	return c, nil
+}
+
+// Returns a Checker of the annotated lists at paths, compiled in memory
+func compileLists(paths []string) (*Checker, error) {
+	var files []*os.File
+	var lists []io.Reader
+	defer func() {
+		for _, l := range files {
+			l.Close()
+		}
+	}()
+	for _, path := range paths {
+		l, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, l)
+		lists = append(lists, l)
+	}
+	var buf bytes.Buffer
+	if err := Compile(&buf, Metadata{}, lists...); err != nil {
+		return nil, err
+	}
+	return NewChecker(&buf)
+}
+
+// Returns 0 for a word found literally in the spelling list and larger
+// numbers for words derived by increasingly elaborate paths: 1 if
+// suffixes were stripped, plus 2 for each prefix (8 for more than 4)
+func (q *query) elaborateness() int {
+	n := 0
+	if q.suffcount > 0 {
+		n = 1
+	}
+	if q.prefcount > 4 {
+		return n + 8
+	}
+	return n + 2*q.prefcount
+}
+
+// Returns the byte at i in the stem buffer, or 0 outside of it
+func (q *query) at(i int) byte {
+	if i < 0 || i >= len(q.word) {
+		return 0
+	}
+	return q.word[i]
+}
+
 func pair(a, b uint8) bits {
 	return (bits(a) << 8) | bits(b)
 }
@@ -39,66 +205,274 @@ func pair(a, b uint8) bits {
 const dLEV = 2
 const dSIZ = 40 // Deriv Size
 
-var vflag bool
-var xflag bool
-
 // main function for spell (equivalent to main in sprog.c in v10spell)
+// Prints, sorted and without repetition, the words of the named files
+// (or standard input) that are not derivable from the spelling list
 func Spell() {
-	usr, err := user.Current()
-	homeDir := "/"
-	if err == nil {
-		homeDir = usr.HomeDir
-	}
-	libDir := path.Join(homeDir, "usr", "local", "lib", "v10spell")
-	defaultDictPath := path.Join(libDir, "amspell")
-
-	f := flag.String("f", defaultDictPath, "Path to encoded spell dictionary file (created with pcode)")
+	f := flag.String("f", "", "Path to encoded spell dictionary file (created with pcode). Defaults to the built-in American or British list")
+	b := flag.Bool("b", false, "British spelling: check against the British list and take -ise for -ize")
+	r := flag.String("r", "", "Path to a file of affix rules to derive words by. Defaults to the built-in rules of v10spell (dictionaries/rules)")
 	v := flag.Bool("v", false, "Print all words not literally in the spelling list, with derivations")
 	x := flag.Bool("x", false, "Print on standard error, marked with =, every stem as it is looked up in the spelling list, along with its affix classes. Typically used for maintenance.")
-	// Skipping these flags:
-	// -b British spelling (can be achieved by using -f brspell)
-	// -c Input is one word per line. Outputs + if word known and - if word rejected.
-	// -C Input is one word per line. Outputs 0 if word known. Larger numbers indicate words derived by increasingly elaborate paths. Typically used by other programs piping queries to v10spell.
-
-	// Global flags
-	vflag = *v
-	xflag = *x
-
-	space, spacep := readDict(*f)
-
-	// reset affix
-
-	if len(os.Args) <= 1 {
-		s := bufio.NewScanner(os.Stdin)
-		for s.Scan() {
-			line := s.Text()
-			fields := strings.Fields(line)
-			for _, word := range fields {
-				// Check each word
+	cf := flag.Bool("c", false, "Input is one word per line. Outputs + if word known and - if word rejected.")
+	Cf := flag.Bool("C", false, "Input is one word per line. Outputs 0 if word known. Larger numbers indicate words derived by increasingly elaborate paths. Typically used by other programs piping queries to v10spell.")
+	flag.Parse()
+
+	c, err := openChecker(*f, *b, *r)
+	if err != nil {
+		fatalf("spell: %v\n", err)
+	}
+	if *x {
+		c.x = os.Stderr
+	}
+
+	if *cf || *Cf {
+		if flag.NArg() == 0 {
+			if err := c.answer(os.Stdin, os.Stdout, *Cf); err != nil {
+				fatalf("%v\n", err)
 			}
 		}
-		err = s.Err()
-		if err != nil {
+		for _, path := range flag.Args() {
+			f, err := os.Open(path)
+			if err != nil {
+				fatalf("cannot open %s\n", path)
+			}
+			err = c.answer(f, os.Stdout, *Cf)
+			f.Close()
+			if err != nil {
+				fatalf("%v\n", err)
+			}
+		}
+		return
+	}
+
+	words := make(map[string]bool)
+	if flag.NArg() == 0 {
+		if err := collectWords(os.Stdin, words); err != nil {
 			fatalf("%v\n", err)
 		}
 	}
 
-	for _, path := range os.Args[1:] {
+	for _, path := range flag.Args() {
 		f, err := os.Open(path)
 		if err != nil {
 			fatalf("cannot open %s\n", path)
 		}
-		defer f.Close()
-		s := bufio.NewScanner(f)
-		for s.Scan() {
-			line := s.Text()
-			fields := strings.Fields(line)
-			// TODO: Check each word
-		}
-		err = s.Err()
+		err = collectWords(f, words)
+		f.Close()
 		if err != nil {
 			fatalf("%v\n", err)
 		}
 	}
 
+	sorted := make([]string, 0, len(words))
+	for word := range words {
+		sorted = append(sorted, word)
+	}
+	sort.Strings(sorted)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, word := range sorted {
+		q, h := c.query(word)
+		if h == 0 || isSet(h, STOP) {
+			fmt.Fprintln(out, word)
+		} else if *v && q.affix != "" {
+			fmt.Fprintf(out, "%s\t%s\n", q.affix, word)
+		}
+	}
+}
+
+// Adds the words of the text read from r to words
+func collectWords(r io.Reader, words map[string]bool) error {
+	s := bufio.NewScanner(r)
+	s.Split(scanWords)
+	for s.Scan() {
+		words[s.Text()] = true
+	}
+	return s.Err()
+}
+
+// Reads one word per line from r and writes a line for each to w: - if
+// the word is rejected, otherwise + or, if elaborate, the elaborateness
+// of its derivation. Output is flushed after every line so that spell
+// can be driven as a coprocess
+func (c *Checker) answer(r io.Reader, w io.Writer, elaborate bool) error {
+	s := bufio.NewScanner(r)
+	out := bufio.NewWriter(w)
+	for s.Scan() {
+		q, h := c.query(strings.TrimSpace(s.Text()))
+		if h == 0 || isSet(h, STOP) {
+			fmt.Fprintln(out, "-")
+		} else if elaborate {
+			fmt.Fprintln(out, q.elaborateness())
+		} else {
+			fmt.Fprintln(out, "+")
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Returns the affix classes of the stem from which the word of the
+// query is derived, 0 if it is not in the spelling list. Words in
+// capitals are also tried with only an initial capital, and capitalized
+// words in lower case
+func (q *query) check() bits {
+	word := q.orig
+	if isDigit(word[0]) && ordinal(word) {
+		return NOUN
+	}
+
+	flag := ALL | STOP | DONT_TOUCH
+	low := strings.IndexFunc(word, unicode.IsLower) >= 0
+
+	var h bits
+	if !low {
+		if h = q.trypref(q.n, ".", 0, flag); h != 0 {
+			return h
+		}
+		n := firstLen([]byte(word))
+		word = word[:n] + strings.ToLower(word[n:])
+		q.respell(word)
+	}
+	for pass := 0; pass < 2; pass++ {
+		if h = q.trypref(q.n, ".", 0, flag); h != 0 {
+			break
+		}
+		if h = q.trysuff(q.n, 0, flag); h != 0 {
+			break
+		}
+		n := firstLen([]byte(word))
+		first := strings.ToLower(word[:n])
+		if !startsUpper([]byte(word)) || first == word[:n] {
+			break
+		}
+		word = first + word[n:]
+		q.respell(word)
+	}
+	return h
+}
+
+// Returns true if word is a number with an ordinal suffix (1st, 22nd, 13th)
+func ordinal(word string) bool {
+	i := 0
+	for i < len(word) && isDigit(word[i]) {
+		i++
+	}
+	if i == 0 || i == len(word) {
+		return false
+	}
+	suffix := strings.ToLower(word[i:])
+	tens := i > 1 && word[i-2] == '1'
+	switch word[i-1] {
+	case '1':
+		return suffix == "st" && !tens || suffix == "th" && tens
+	case '2':
+		return suffix == "nd" && !tens || suffix == "th" && tens
+	case '3':
+		return suffix == "rd" && !tens || suffix == "th" && tens
+	}
+	return suffix == "th"
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// Returns the length in bytes of the first character of w
+func firstLen(w []byte) int {
+	_, n := utf8.DecodeRune(w)
+	return n
+}
+
+// Returns true if the word w starts with an upper case letter
+func startsUpper(w []byte) bool {
+	if len(w) > 0 && w[0] < utf8.RuneSelf {
+		return isUpper(w[0])
+	}
+	r, _ := utf8.DecodeRune(w)
+	return unicode.IsUpper(r)
+}
+
+// Returns true if c may be part of a word: letters, digits and
+// apostrophes (o'clock, John's)
+func isWordByte(c byte) bool {
+	return isLower(c) || isUpper(c) || isDigit(c) || c == '\''
+}
+
+// Returns true if r may be part of a word: as isWordByte, or a
+// non-ASCII letter or combining mark (café, Zürich)
+func isWordRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isWordByte(byte(r))
+	}
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
+
+// Returns true if r is a letter
+func isLetter(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isLower(byte(r)) || isUpper(byte(r))
+	}
+	return unicode.IsLetter(r)
+}
+
+// bufio.SplitFunc that returns the words of the input, in the manner of
+// deroff -w. Apostrophes are kept only inside words, and words without
+// letters or of a single character are skipped. Input is UTF-8
+func scanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Returns the length of the UTF-8 word character at data[i], 0 if
+	// there is none, -1 if more data is needed to tell
+	wordLen := func(i int) int {
+		if data[i] < utf8.RuneSelf {
+			if isWordByte(data[i]) {
+				return 1
+			}
+			return 0
+		}
+		if !atEOF && !utf8.FullRune(data[i:]) {
+			return -1
+		}
+		r, n := utf8.DecodeRune(data[i:])
+		if isWordRune(r) {
+			return n
+		}
+		return 0
+	}
+	for start := 0; start < len(data); {
+		for start < len(data) {
+			n := wordLen(start)
+			if n < 0 {
+				return start, nil, nil
+			}
+			if n > 0 {
+				break
+			}
+			_, size := utf8.DecodeRune(data[start:])
+			start += size
+		}
+		end := start
+		for end < len(data) {
+			n := wordLen(end)
+			if n < 0 {
+				return start, nil, nil
+			}
+			if n == 0 {
+				break
+			}
+			end += n
+		}
+		if end == len(data) && !atEOF {
+			return start, nil, nil
+		}
+		word := bytes.Trim(data[start:end], "'")
+		if utf8.RuneCount(word) > 1 && bytes.IndexFunc(word, isLetter) >= 0 {
+			return end, word, nil
+		}
+		start = end
+	}
+	return len(data), nil, nil
 }
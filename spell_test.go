@@ -0,0 +1,177 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// Returns the dictionary file of md compiled from the annotated list,
+// and the words and codes it holds
+func testDictFile(t testing.TB, md Metadata, list string) ([]byte, []dict, []bits) {
+	t.Helper()
+	words, encodes, err := readWordEncodings(nil, nil, bufio.NewScanner(strings.NewReader(list)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := writeDictFile(md, words, encodes, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), words, encodes
+}
+
+// Returns a Checker for the annotated list compiled as md
+func testChecker(t testing.TB, md Metadata, list string) *Checker {
+	t.Helper()
+	data, _, _ := testDictFile(t, md, list)
+	c, err := NewChecker(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Returns the annotated lists at paths, one after the other
+func testList(t testing.TB, paths ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+	}
+	return b.String()
+}
+
+var amspellPaths = []string{
+	"dictionaries/list",
+	"dictionaries/american",
+	"dictionaries/local",
+	"dictionaries/stop",
+}
+
+func TestCheck(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	tests := []struct {
+		word string
+		ok   bool
+	}{
+		{"aardvark", true},
+		{"happiness", true},
+		{"Happiness", true},
+		{"HAPPINESS", true},
+		{"unreadable", true},
+		{"immunotherapy", true},
+		{"AARP", true},
+		{"Aarp", false},
+		{"3B2", true},
+		{"bpses", true}, // the stem of the second op of -es needs no vowel
+		{"1st", true},
+		{"11th", true},
+		{"11st", false},
+		{"22nd", true},
+		{"accidently", false},
+		{"teh", false},
+		{"zzzz", false},
+	}
+	for _, test := range tests {
+		if ok := c.Check(test.word); ok != test.ok {
+			t.Errorf("%s: got %v, want %v", test.word, ok, test.ok)
+		}
+	}
+}
+
+func TestScanWords(t *testing.T) {
+	text := "The cat's \"hat\", 2 o'clock-ish 'quoted' x 22nd; 1984 end"
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Split(scanWords)
+	var words []string
+	for s.Scan() {
+		words = append(words, s.Text())
+	}
+	want := []string{"The", "cat's", "hat", "o'clock", "ish", "quoted", "22nd", "end"}
+	if !reflect.DeepEqual(words, want) {
+		t.Fatalf("got %q, want %q", words, want)
+	}
+}
+
+func TestScanWordsUTF8(t *testing.T) {
+	text := "Zürich's café—naïve cafe\u0301s, \u00e9 déjà-vu \xff 42€"
+	// Feed the scanner a byte at a time, splitting the runes
+	s := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(text)))
+	s.Split(scanWords)
+	var words []string
+	for s.Scan() {
+		words = append(words, s.Text())
+	}
+	want := []string{"Zürich's", "café", "naïve", "cafe\u0301s", "déjà", "vu"}
+	if !reflect.DeepEqual(words, want) {
+		t.Fatalf("got %q, want %q", words, want)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	input := "aardvark\naardvarks\nreread\nunreadable\nteh\naccidently\n\n1st\n"
+	for _, test := range []struct {
+		elaborate bool
+		want      string
+	}{
+		{false, "+\n+\n+\n+\n-\n-\n-\n+\n"},
+		{true, "0\n1\n2\n3\n-\n-\n-\n0\n"},
+	} {
+		var out strings.Builder
+		if err := c.answer(strings.NewReader(input), &out, test.elaborate); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("answer(elaborate=%v) = %q, want %q", test.elaborate, out.String(), test.want)
+		}
+	}
+}
+
+func TestDerivation(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	tests := []struct {
+		word, affix string
+	}{
+		{"aardvark", ""},
+		{"aardvarks", "+s"},
+		{"flies", "-y+ies"},
+		{"fibbing", "+b+ing"},
+		{"happiness", "+p+y-y+iness"},
+		{"readability", "+able-le+ility"},
+		{"immunotherapy", "immuno+"},
+		{"unreadable", "un+able"},
+		{"unreconstructed", "un+re+ed"},
+	}
+	for _, test := range tests {
+		q, h := c.query(test.word)
+		if h == 0 {
+			t.Errorf("%s: not found", test.word)
+		} else if q.affix != test.affix {
+			t.Errorf("%s: derivation %q, want %q", test.word, q.affix, test.affix)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	c := testChecker(t, Metadata{}, testList(t, amspellPaths...))
+	var x strings.Builder
+	c.x = &x
+	c.Check("fibbing")
+	want := "=fibbing\n=fibb\n=fib ED|NOUN|ACTOR|V_IRREG|MONO\n"
+	if x.String() != want {
+		t.Fatalf("got %q, want %q", x.String(), want)
+	}
+	if s := codeToStr(0); s != "0" {
+		t.Fatalf("codeToStr(0) = %q", s)
+	}
+}
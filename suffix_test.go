@@ -0,0 +1,96 @@
+package spell
+
+import (
+	"strings"
+	"testing"
+)
+
+// Returns a dictionary lookup over entries of the form "word<TAB>codes"
+func testDict(t *testing.T, entries ...string) func(w []byte) bits {
+	m := make(map[string]bits)
+	for _, e := range entries {
+		fields := strings.Fields(e)
+		code, err := strToCode(fields[1])
+		if err != nil {
+			t.Fatalf("bad test entry %q: %v", e, err)
+		}
+		m[fields[0]] = code
+	}
+	return func(w []byte) bits {
+		return m[string(w)]
+	}
+}
+
+// Looks w up the way the top level of spell does, without case folding
+func derive(dict func(w []byte) bits, w string) bits {
+	q := newQuery(w, dict)
+	flag := ALL | STOP | DONT_TOUCH
+	h := q.trypref(len(w), ".", 0, flag)
+	if h == 0 {
+		h = q.trysuff(len(w), 0, flag)
+	}
+	return h
+}
+
+var suffixDict = []string{
+	"box	n,v,er,na,y",
+	"church	n,ed,a,man,y",
+	"create	v,ion",
+	"fib	n,v,er,ms",
+	"fly	n,v,va",
+	"hap	n,v,a,ms,y",
+	"hope	n,v,er,na",
+	"holograph	n",
+	"read	n,vi,er,va",
+	"shy	n,v,a,comp",
+	"silly	a,comp",
+	"accidently	s",
+}
+
+func TestTrysuff(t *testing.T) {
+	dict := testDict(t, suffixDict...)
+	tests := []struct {
+		word string
+		ok   bool
+	}{
+		{"box", true},
+		{"boxes", true},
+		{"boxs", false},
+		{"churches", true},
+		{"creation", true},
+		{"creator", true},
+		{"fibbing", true},
+		{"fibing", false},
+		{"flies", true},
+		{"happy", true},
+		{"happily", true},
+		{"happiness", true},
+		{"happinesses", true},
+		{"happyness", false},
+		{"hoping", true},
+		{"hopeful", true},
+		{"hologram", true},
+		{"readable", true},
+		{"readability", true},
+		{"shyness", true},
+		{"sillly", false},
+		{"accidently", false},
+	}
+	for _, test := range tests {
+		h := derive(dict, test.word)
+		if ok := h != 0 && !isSet(h, STOP); ok != test.ok {
+			t.Errorf("%s: got %v, want %v (code %#x)", test.word, ok, test.ok, h)
+		}
+	}
+}
+
+func TestTrysuffRestoresWord(t *testing.T) {
+	dict := testDict(t, suffixDict...)
+	for _, w := range []string{"hologram", "readability", "hopeful", "creation", "flies"} {
+		q := newQuery(w, dict)
+		q.trysuff(len(w), 0, ALL|STOP|DONT_TOUCH)
+		if got := string(q.word[:len(w)]); got != w {
+			t.Errorf("trysuff(%q) left %q in the buffer", w, got)
+		}
+	}
+}